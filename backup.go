@@ -0,0 +1,125 @@
+package danikor
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+// BackupSchemaVersion is the version of the backup file format written by
+// WriteBackup. ReadBackup refuses files from a newer version.
+const BackupSchemaVersion = 1
+
+var ErrBackupVersion = errors.New("danikor: unsupported backup schema version")
+
+// ControllerInfo identifies the controller a backup was taken from. No MID
+// for a serial number or firmware version is known and a replacement often
+// takes over the address, so Name is left to whoever takes the backup, e.g.
+// the serial number on the controller's plate or its station.
+type ControllerInfo struct {
+	Address string `json:"address"`
+	Name    string `json:"name,omitempty"`
+}
+
+// BackupPset is one pset program in a backup.
+type BackupPset struct {
+	Number int  `json:"number"`
+	Pset   Pset `json:"pset"`
+}
+
+// Backup is a snapshot of every pset program of one controller.
+type Backup struct {
+	SchemaVersion int            `json:"schema_version"`
+	Created       time.Time      `json:"created"`
+	Controller    ControllerInfo `json:"controller"`
+	Psets         []BackupPset   `json:"psets"`
+}
+
+// Backup reads psets 1 to MaxPset from the controller.
+func (dc *DanikorTCPConnection) Backup(ctx context.Context) (*Backup, error) {
+	b := &Backup{
+		SchemaVersion: BackupSchemaVersion,
+		Created:       time.Now().UTC(),
+		Controller:    ControllerInfo{Address: dc.address},
+	}
+	for n := 1; n <= MaxPset; n++ {
+		p, err := dc.GetPset(ctx, n)
+		if err != nil {
+			return nil, fmt.Errorf("backup pset %d: %w", n, err)
+		}
+		b.Psets = append(b.Psets, BackupPset{Number: n, Pset: p})
+	}
+	return b, nil
+}
+
+// Restore writes the psets of b to the controller, e.g. a replacement for
+// the one b was taken from. Every pset is validated before the first one is
+// written. It returns the changes made per pset number.
+func (dc *DanikorTCPConnection) Restore(ctx context.Context, b *Backup) (map[int][]PsetChange, error) {
+	if b.SchemaVersion < 1 || b.SchemaVersion > BackupSchemaVersion {
+		return nil, fmt.Errorf("%w: %d", ErrBackupVersion, b.SchemaVersion)
+	}
+	for _, bp := range b.Psets {
+		if err := checkPset(bp.Number); err != nil {
+			return nil, err
+		}
+		if err := bp.Pset.Validate(); err != nil {
+			return nil, fmt.Errorf("pset %d: %w", bp.Number, err)
+		}
+	}
+
+	changes := make(map[int][]PsetChange)
+	for _, bp := range b.Psets {
+		c, err := dc.SetPset(ctx, bp.Number, bp.Pset)
+		if err != nil {
+			return changes, fmt.Errorf("restore pset %d: %w", bp.Number, err)
+		}
+		if len(c) > 0 {
+			changes[bp.Number] = c
+		}
+	}
+	return changes, nil
+}
+
+// DiffBackups lists per pset number what changes when going from a to b.
+// A pset missing on one side is compared against an empty program.
+func DiffBackups(a, b *Backup) map[int][]PsetChange {
+	psets := func(bk *Backup) map[int]Pset {
+		m := make(map[int]Pset)
+		for _, bp := range bk.Psets {
+			m[bp.Number] = bp.Pset
+		}
+		return m
+	}
+	pa, pb := psets(a), psets(b)
+
+	diff := make(map[int][]PsetChange)
+	for n := 1; n <= MaxPset; n++ {
+		if c := pa[n].Diff(pb[n]); len(c) > 0 {
+			diff[n] = c
+		}
+	}
+	return diff
+}
+
+// WriteBackup writes b as indented JSON.
+func WriteBackup(w io.Writer, b *Backup) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(b)
+}
+
+// ReadBackup reads a file written by WriteBackup.
+func ReadBackup(r io.Reader) (*Backup, error) {
+	var b Backup
+	if err := json.NewDecoder(r).Decode(&b); err != nil {
+		return nil, err
+	}
+	if b.SchemaVersion < 1 || b.SchemaVersion > BackupSchemaVersion {
+		return nil, fmt.Errorf("%w: %d", ErrBackupVersion, b.SchemaVersion)
+	}
+	return &b, nil
+}
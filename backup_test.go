@@ -0,0 +1,118 @@
+package danikor
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// storePset puts p into a paramServer store with DefaultPsetLayout.
+func storePset(store map[string]map[string]string, n int, p Pset) {
+	l := DefaultPsetLayout
+	store[l.MID(n)] = map[string]string{
+		l.TargetTorque: formatValue(p.TargetTorque),
+		l.TorqueMin:    formatValue(p.TorqueMin),
+		l.TorqueMax:    formatValue(p.TorqueMax),
+		l.AngleMin:     formatValue(p.AngleMin),
+		l.AngleMax:     formatValue(p.AngleMax),
+		l.Speed:        formatValue(p.Speed),
+		l.TimeLimit:    formatValue(p.TimeLimit),
+		l.StageCount:   strconv.Itoa(len(p.Stages)),
+	}
+	for _, s := range p.Stages {
+		store[l.StageMID(n, s.Index)] = map[string]string{
+			l.StageTargetTorque: formatValue(s.TargetTorque),
+			l.StageSpeed:        formatValue(s.Speed),
+			l.StageAngleMin:     formatValue(s.AngleMin),
+			l.StageAngleMax:     formatValue(s.AngleMax),
+		}
+	}
+}
+
+func testPset(torque float64) Pset {
+	return Pset{
+		TargetTorque: torque, TorqueMin: torque - 0.5, TorqueMax: torque + 0.5, AngleMax: 1440, Speed: 300, TimeLimit: 5,
+		Stages: []StageSetting{{Index: 1, TargetTorque: torque, Speed: 200, AngleMax: 720}},
+	}
+}
+
+func TestBackupRestore(t *testing.T) {
+	ctx := context.Background()
+	oldStore := map[string]map[string]string{}
+	newStore := map[string]map[string]string{}
+	for n := 1; n <= MaxPset; n++ {
+		storePset(oldStore, n, testPset(float64(n)))
+		storePset(newStore, n, testPset(1))
+	}
+	oldController := paramServer(t, oldStore)
+	newController := paramServer(t, newStore)
+
+	b, err := oldController.Backup(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.Controller.Name = "SN20231107"
+	var buf bytes.Buffer
+	if err := WriteBackup(&buf, b); err != nil {
+		t.Fatal(err)
+	}
+	if b.Controller.Address != oldController.address {
+		t.Fatalf("got controller %+v", b.Controller)
+	}
+	if !strings.Contains(buf.String(), `"schema_version": 1`) {
+		t.Fatalf("backup file misses its header:\n%s", buf.String())
+	}
+	read, err := ReadBackup(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if read.Controller != b.Controller {
+		t.Fatalf("round trip changed the controller: %+v", read.Controller)
+	}
+	if !reflect.DeepEqual(read.Psets, b.Psets) {
+		t.Fatalf("round trip changed psets:\n%+v\n%+v", read.Psets, b.Psets)
+	}
+
+	before, err := newController.Backup(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	diff := DiffBackups(before, read)
+	if len(diff) != MaxPset-1 || diff[1] != nil {
+		t.Fatalf("got diff for psets %v, want 2..%d", diff, MaxPset)
+	}
+
+	changes, err := newController.Restore(ctx, read)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(changes, diff) {
+		t.Fatalf("restore changed %v, want %v", changes, diff)
+	}
+	after, err := newController.Backup(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := DiffBackups(after, b); len(d) != 0 {
+		t.Fatalf("controller differs from the backup after restore: %v", d)
+	}
+}
+
+func TestRestoreInvalidPset(t *testing.T) {
+	dc := paramServer(t, map[string]map[string]string{})
+	b := &Backup{SchemaVersion: BackupSchemaVersion, Psets: []BackupPset{{Number: 9, Pset: testPset(1)}}}
+	if _, err := dc.Restore(context.Background(), b); !errors.Is(err, ErrInvalidPset) {
+		t.Fatalf("got %v, want ErrInvalidPset", err)
+	}
+}
+
+func TestReadBackupVersion(t *testing.T) {
+	_, err := ReadBackup(strings.NewReader(`{"schema_version": 2, "psets": []}`))
+	if !errors.Is(err, ErrBackupVersion) {
+		t.Fatalf("got %v, want ErrBackupVersion", err)
+	}
+}
@@ -0,0 +1,186 @@
+package danikor
+
+import (
+	"bufio"
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+var ErrBadCapture = errors.New("danikor: bad capture line")
+
+// CaptureDirection tells whether a captured frame was sent or received by
+// the host, or whether the entry holds received bytes that were no frame.
+type CaptureDirection byte
+
+const (
+	Sent      CaptureDirection = 'S'
+	Received  CaptureDirection = 'R'
+	Discarded CaptureDirection = 'D' // skipped by the FrameReader: a broken header, length or tailer, or a cut off frame
+)
+
+func (d CaptureDirection) String() string {
+	switch d {
+	case Sent:
+		return "sent"
+	case Received:
+		return "received"
+	case Discarded:
+		return "discarded"
+	}
+	return fmt.Sprintf("CaptureDirection(%q)", byte(d))
+}
+
+// CapturedFrame is one frame of a capture.
+type CapturedFrame struct {
+	Time      time.Time
+	Direction CaptureDirection
+	Frame     []byte
+}
+
+// captureHeader starts every capture file.
+const captureHeader = "# danikor capture v1"
+
+// CaptureWriter writes a capture: a text file with one frame per line, the
+// time in RFC 3339 with nanoseconds, S, R or D and the bytes in hex, e.g.
+//
+//	2024-05-06T07:08:09.123456789Z R 0200000008413030303141434b03
+//
+// It is safe for concurrent use.
+type CaptureWriter struct {
+	mu     sync.Mutex
+	w      io.Writer
+	header bool
+}
+
+func NewCaptureWriter(w io.Writer) *CaptureWriter {
+	return &CaptureWriter{w: w}
+}
+
+// Write appends one frame to the capture.
+func (cw *CaptureWriter) Write(f CapturedFrame) error {
+	cw.mu.Lock()
+	defer cw.mu.Unlock()
+	var b strings.Builder
+	if !cw.header {
+		b.WriteString(captureHeader + "\n")
+	}
+	fmt.Fprintf(&b, "%s %c %s\n", f.Time.UTC().Format(time.RFC3339Nano), f.Direction, hex.EncodeToString(f.Frame))
+	if _, err := io.WriteString(cw.w, b.String()); err != nil {
+		return err
+	}
+	cw.header = true
+	return nil
+}
+
+// record writes frame to the recorder set with WithRecorder, if any.
+func (dc *DanikorTCPConnection) record(d CaptureDirection, frame []byte) {
+	if dc.recorder == nil {
+		return
+	}
+	f := CapturedFrame{Time: time.Now(), Direction: d, Frame: append([]byte(nil), frame...)}
+	if err := dc.recorder.Write(f); err != nil {
+		dc.reportError(fmt.Errorf("danikor: recording: %w", err))
+	}
+}
+
+// CaptureReader reads a capture written by CaptureWriter.
+type CaptureReader struct {
+	scanner *bufio.Scanner
+	line    int
+}
+
+func NewCaptureReader(r io.Reader) *CaptureReader {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 2*MaxFrameLen+64)
+	return &CaptureReader{scanner: scanner}
+}
+
+// Read returns the next frame, or io.EOF at the end of the capture.
+func (cr *CaptureReader) Read() (CapturedFrame, error) {
+	for cr.scanner.Scan() {
+		cr.line++
+		line := strings.TrimSpace(cr.scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 3 || len(fields[1]) != 1 {
+			return CapturedFrame{}, fmt.Errorf("%w %d: %q", ErrBadCapture, cr.line, line)
+		}
+		t, err := time.Parse(time.RFC3339Nano, fields[0])
+		if err != nil {
+			return CapturedFrame{}, fmt.Errorf("%w %d: %v", ErrBadCapture, cr.line, err)
+		}
+		d := CaptureDirection(fields[1][0])
+		if d != Sent && d != Received && d != Discarded {
+			return CapturedFrame{}, fmt.Errorf("%w %d: direction %q", ErrBadCapture, cr.line, fields[1])
+		}
+		frame, err := hex.DecodeString(fields[2])
+		if err != nil {
+			return CapturedFrame{}, fmt.Errorf("%w %d: %v", ErrBadCapture, cr.line, err)
+		}
+		return CapturedFrame{Time: t, Direction: d, Frame: frame}, nil
+	}
+	if err := cr.scanner.Err(); err != nil {
+		return CapturedFrame{}, err
+	}
+	return CapturedFrame{}, io.EOF
+}
+
+// PlayCapture reads the capture from r and calls fn with every frame, keeping
+// the recorded gaps between frames divided by speed: 1 is the original
+// pace, 10 ten times faster and 0 as fast as possible.
+func PlayCapture(ctx context.Context, r io.Reader, speed float64, fn func(CapturedFrame) error) error {
+	cr := NewCaptureReader(r)
+	var first time.Time
+	start := time.Now()
+	for {
+		f, err := cr.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if first.IsZero() {
+			first = f.Time
+		}
+		if speed > 0 {
+			at := start.Add(time.Duration(float64(f.Time.Sub(first)) / speed))
+			if wait := time.Until(at); wait > 0 {
+				t := time.NewTimer(wait)
+				select {
+				case <-ctx.Done():
+					t.Stop()
+					return ctx.Err()
+				case <-t.C:
+				}
+			}
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := fn(f); err != nil {
+			return err
+		}
+	}
+}
+
+// Replay feeds the received frames of a capture through the same parsing
+// and dispatch as live frames: receiveCallBack, the subscriptions, Cycles
+// and so on see them as if the controller had just sent them. The
+// connection does not need to be dialed. See PlayCapture for speed.
+func (dc *DanikorTCPConnection) Replay(ctx context.Context, r io.Reader, speed float64) error {
+	return PlayCapture(ctx, r, speed, func(f CapturedFrame) error {
+		if f.Direction == Received {
+			dc.dispatch(f.Frame, func(deliver func()) { deliver() })
+		}
+		return nil
+	})
+}
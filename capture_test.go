@@ -0,0 +1,193 @@
+package danikor
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCaptureRoundTrip(t *testing.T) {
+	t0 := time.Date(2024, 5, 6, 7, 8, 9, 123456789, time.UTC)
+	frames := []CapturedFrame{
+		{Time: t0, Direction: Sent, Frame: mustHex(t, "0200000005523030303103")},
+		{Time: t0.Add(time.Millisecond), Direction: Received, Frame: mustHex(t, "0200000008413030303141434b03")},
+	}
+	var buf bytes.Buffer
+	cw := NewCaptureWriter(&buf)
+	for _, f := range frames {
+		if err := cw.Write(f); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want := captureHeader + "\n" +
+		"2024-05-06T07:08:09.123456789Z S 0200000005523030303103\n" +
+		"2024-05-06T07:08:09.124456789Z R 0200000008413030303141434b03\n"
+	if buf.String() != want {
+		t.Fatalf("got capture\n%s\nwant\n%s", buf.String(), want)
+	}
+
+	cr := NewCaptureReader(&buf)
+	for _, w := range frames {
+		f, err := cr.Read()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !f.Time.Equal(w.Time) || f.Direction != w.Direction || !bytes.Equal(f.Frame, w.Frame) {
+			t.Fatalf("got %+v, want %+v", f, w)
+		}
+	}
+	if _, err := cr.Read(); err != io.EOF {
+		t.Fatalf("got %v at the end, want io.EOF", err)
+	}
+
+	for _, line := range []string{"garbage", "2024-05-06T07:08:09Z X 02", "2024-05-06T07:08:09Z R 0g"} {
+		if _, err := NewCaptureReader(strings.NewReader(line)).Read(); !errors.Is(err, ErrBadCapture) {
+			t.Fatalf("%q: got %v, want ErrBadCapture", line, err)
+		}
+	}
+}
+
+func TestRecordAndReplay(t *testing.T) {
+	addr, _ := ackServer(t, nil)
+	var capture bytes.Buffer
+	dc := NewDanikorTCPConnection(addr, nil, WithRecorder(&capture))
+	if err := dc.DialContext(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := dc.Establish(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	dc.Close()
+
+	var got []string
+	cr := NewCaptureReader(bytes.NewReader(capture.Bytes()))
+	for {
+		f, err := cr.Read()
+		if err != nil {
+			break
+		}
+		got = append(got, f.Direction.String()+" "+string(f.Frame[5:len(f.Frame)-1]))
+	}
+	if len(got) != 2 || got[0] != "sent R0001" || got[1] != "received A0001ACK" {
+		t.Fatalf("got capture %q", got)
+	}
+
+	// a recorded cycle, 100ms from curve to result
+	t0 := time.Now()
+	var buf bytes.Buffer
+	cw := NewCaptureWriter(&buf)
+	cw.Write(CapturedFrame{Time: t0, Direction: Received, Frame: mustHex(t, testCurveFrame)})
+	cw.Write(CapturedFrame{Time: t0, Direction: Sent, Frame: mustHex(t, "0200000005523030303103")})
+	end := strings.Replace(testCurveFrame, "303230313d30", "303230313d31", 1) // 0201=1, the end
+	end = strings.Replace(end, "303230323d31", "303230323d30", 1)             // 0202=0, not a start
+	cw.Write(CapturedFrame{Time: t0.Add(50 * time.Millisecond), Direction: Received, Frame: mustHex(t, end)})
+	cw.Write(CapturedFrame{Time: t0.Add(100 * time.Millisecond), Direction: Received, Frame: mustHex(t, testResultFrame)})
+
+	var frames int
+	replay := NewDanikorTCPConnection("", func(AnsData) { frames++ })
+	cycles, cancel := replay.Cycles()
+	defer cancel()
+	start := time.Now()
+	if err := replay.Replay(context.Background(), &buf, 10); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed < 10*time.Millisecond {
+		t.Fatalf("replay at 10x took %v, want at least 10ms", elapsed)
+	}
+	if frames != 3 {
+		t.Fatalf("got %d frames, want the 3 received ones", frames)
+	}
+	select {
+	case c := <-cycles:
+		if c.Curve == nil || len(c.Curve.Torque) != 2 || c.Result == nil {
+			t.Fatalf("got cycle %+v %+v", c.Curve, c.Result)
+		}
+	default:
+		t.Fatal("replay produced no cycle")
+	}
+}
+
+func TestRecordDiscarded(t *testing.T) {
+	client, server := net.Pipe()
+	go func() {
+		// an ack with its tailer broken, a good one, then half a frame
+		sendHexString(server, "0200000008413030303141434bff")
+		sendHexString(server, "0200000008413030303141434b03")
+		sendHexString(server, "02000000084130")
+		server.Close()
+	}()
+
+	var capture bytes.Buffer
+	dc := NewDanikorTCPConnection("", nil, WithRecorder(&capture), WithErrorCallBack(func(error) {}))
+	dc.attach(client)
+	<-dc.drained
+	dc.Close()
+
+	var got []string
+	cr := NewCaptureReader(&capture)
+	for {
+		f, err := cr.Read()
+		if err != nil {
+			break
+		}
+		got = append(got, string(f.Direction)+" "+hex.EncodeToString(f.Frame))
+	}
+	want := []string{
+		"D 0200000008413030303141434bff",
+		"R 0200000008413030303141434b03",
+		"D 02000000084130",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got capture %q, want %q", got, want)
+	}
+}
+
+func TestRecordLongDiscard(t *testing.T) {
+	client, server := net.Pipe()
+	// a length that keeps the reader waiting for 64k, then no tailer
+	junk := "020000ffff" + strings.Repeat("55", 70000)
+	go func() {
+		sendHexString(server, junk)
+		sendHexString(server, "0200000008413030303141434b03")
+		server.Close()
+	}()
+
+	var capture bytes.Buffer
+	dc := NewDanikorTCPConnection("", nil, WithRecorder(&capture), WithErrorCallBack(func(error) {}))
+	dc.attach(client)
+	<-dc.drained
+	dc.Close()
+
+	// the discard is split so every line can be read back
+	var discarded []byte
+	var received int
+	cr := NewCaptureReader(&capture)
+	for {
+		f, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		switch f.Direction {
+		case Discarded:
+			if len(f.Frame) > MaxFrameLen {
+				t.Fatalf("discard entry of %d bytes", len(f.Frame))
+			}
+			discarded = append(discarded, f.Frame...)
+		case Received:
+			received++
+		}
+	}
+	if hex.EncodeToString(discarded) != junk || received != 1 {
+		t.Fatalf("got %d bytes discarded and %d frames, want %d and 1", len(discarded), received, len(junk)/2)
+	}
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+
+	. "github.com/linexjlin/danikor"
+)
+
+// dial connects to addr and establishes the session.
+func dial(addr string) (*DanikorTCPConnection, error) {
+	dc := NewDanikorTCPConnection(addr, nil)
+	ctx := context.Background()
+	if err := dc.DialContext(ctx); err != nil {
+		return nil, fmt.Errorf("dial %s: %w", addr, err)
+	}
+	if _, err := dc.Establish(ctx); err != nil {
+		dc.Close()
+		return nil, fmt.Errorf("establish %s: %w", addr, err)
+	}
+	return dc, nil
+}
+
+func readBackupFile(name string) (*Backup, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	b, err := ReadBackup(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	return b, nil
+}
+
+func printChanges(changes map[int][]PsetChange) {
+	var psets []int
+	for n := range changes {
+		psets = append(psets, n)
+	}
+	sort.Ints(psets)
+	for _, n := range psets {
+		fmt.Printf("pset %d:\n", n)
+		for _, c := range changes[n] {
+			fmt.Println("  ", c)
+		}
+	}
+}
+
+// backup saves every pset of a controller to a file.
+func backup(args []string) error {
+	fs := flag.NewFlagSet("backup", flag.ExitOnError)
+	addr := fs.String("addr", defaultAddr, "controller address")
+	out := fs.String("o", "psets.json", "backup file")
+	name := fs.String("name", "", "what identifies the controller, e.g. its serial number")
+	fs.Parse(args)
+
+	dc, err := dial(*addr)
+	if err != nil {
+		return err
+	}
+	defer dc.Close()
+	b, err := dc.Backup(context.Background())
+	if err != nil {
+		return err
+	}
+	b.Controller.Name = *name
+	f, err := os.Create(*out)
+	if err != nil {
+		return err
+	}
+	if err := WriteBackup(f, b); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// restore writes the psets of a backup file to a controller.
+func restore(args []string) error {
+	fs := flag.NewFlagSet("restore", flag.ExitOnError)
+	addr := fs.String("addr", defaultAddr, "controller address")
+	in := fs.String("i", "psets.json", "backup file")
+	fs.Parse(args)
+
+	b, err := readBackupFile(*in)
+	if err != nil {
+		return err
+	}
+	dc, err := dial(*addr)
+	if err != nil {
+		return err
+	}
+	defer dc.Close()
+	changes, err := dc.Restore(context.Background(), b)
+	printChanges(changes)
+	return err
+}
+
+// diff compares two backup files, or a backup file with a live controller
+// when -addr is given.
+func diff(args []string) error {
+	fs := flag.NewFlagSet("diff", flag.ExitOnError)
+	addr := fs.String("addr", "", "compare the backup with this controller")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: diff a.json b.json | diff -addr host:port a.json")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	var a, b *Backup
+	var err error
+	switch {
+	case *addr != "" && fs.NArg() == 1:
+		if a, err = readBackupFile(fs.Arg(0)); err != nil {
+			return err
+		}
+		dc, err := dial(*addr)
+		if err != nil {
+			return err
+		}
+		defer dc.Close()
+		if b, err = dc.Backup(context.Background()); err != nil {
+			return err
+		}
+	case *addr == "" && fs.NArg() == 2:
+		if a, err = readBackupFile(fs.Arg(0)); err != nil {
+			return err
+		}
+		if b, err = readBackupFile(fs.Arg(1)); err != nil {
+			return err
+		}
+	default:
+		fs.Usage()
+		os.Exit(2)
+	}
+	printChanges(DiffBackups(a, b))
+	return nil
+}
@@ -1,29 +1,121 @@
 package main
 
 import (
+	"context"
+	"flag"
 	"fmt"
+	"os"
+	"strings"
 
 	. "github.com/linexjlin/danikor"
 )
 
+const defaultAddr = "192.168.2.5:5000"
+
 func main() {
-	dc := NewDanikorTCPConnection("192.168.2.5:5000", func(ansData AnsData) {
-		fmt.Println("ansMid:", string(ansData.MID))
-		switch ansData.MID {
-		case "0203":
-			fmt.Printf("torque  %+v\n", ansData)
-			fmt.Println("Pset:", ansData.Torque.Pset, ansData.Torque.IsCurveStart, ansData.Torque.IsCurveEnd)
-		case "0202":
-			fmt.Printf("Ng Reason:%s\n", ansData.TorqueResult.ShowNgCode())
-			fmt.Printf("torque result %+v\n", ansData.TorqueResult)
+	cmd, args := "run", os.Args[1:]
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		cmd, args = args[0], args[1:]
+	}
+	var err error
+	switch cmd {
+	case "run":
+		err = run(args)
+	case "backup":
+		err = backup(args)
+	case "restore":
+		err = restore(args)
+	case "diff":
+		err = diff(args)
+	case "replay":
+		err = replay(args)
+	case "proxy":
+		err = proxy(args)
+	case "line":
+		err = line(args)
+	default:
+		err = fmt.Errorf("unknown command %q, want run, backup, restore, diff, replay, proxy or line", cmd)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func printData(ansData AnsData) {
+	fmt.Println("ansMid:", string(ansData.MID))
+	switch ansData.MID {
+	case "0203":
+		fmt.Printf("torque  %+v\n", ansData)
+		fmt.Println("Pset:", ansData.Torque.Pset, ansData.Torque.IsCurveStart, ansData.Torque.IsCurveEnd)
+	case "0202":
+		fmt.Printf("Ng Reason:%s\n", ansData.TorqueResult.ShowNgCode())
+		fmt.Printf("torque result %+v\n", ansData.TorqueResult)
+	}
+}
+
+func run(args []string) error {
+	fs := flag.NewFlagSet("run", flag.ExitOnError)
+	addr := fs.String("addr", defaultAddr, "controller address")
+	pset := fs.Int("pset", 2, "pset to run")
+	record := fs.String("record", "", "write every frame to this capture file")
+	fs.Parse(args)
+
+	opts := []Option{
+		WithDialErrorHook(func(attempt int, err error) {
+			fmt.Printf("Failed to dial (attempt %d): %v\n", attempt, err)
+		}),
+		WithErrorCallBack(func(err error) {
+			fmt.Println("Error:", err)
+		}),
+	}
+	if *record != "" {
+		f, err := os.Create(*record)
+		if err != nil {
+			return err
 		}
-	})
-
-	dc.Dial()
-	dc.Establish()
-	dc.ChosePset(2)
-	dc.SubscribeRealTimeData()
-	dc.SubscribeResultData()
-	dc.ForwardTurn()
+		defer f.Close()
+		opts = append(opts, WithRecorder(f))
+	}
+	dc := NewDanikorTCPConnection(*addr, printData, opts...)
+
+	ctx := context.Background()
+	if err := dc.DialContext(ctx); err != nil {
+		return fmt.Errorf("dial: %w", err)
+	}
+	if _, err := dc.Establish(ctx); err != nil {
+		fmt.Println("establish:", err)
+	}
+	if _, err := dc.ChosePset(ctx, *pset); err != nil {
+		fmt.Println("chose pset:", err)
+	}
+	if _, err := dc.SubscribeRealTimeData(ctx); err != nil {
+		fmt.Println("subscribe real time data:", err)
+	}
+	if _, err := dc.SubscribeResultData(ctx); err != nil {
+		fmt.Println("subscribe result data:", err)
+	}
+	if _, err := dc.ForwardTurn(ctx); err != nil {
+		fmt.Println("forward turn:", err)
+	}
 	dc.StartReceiveData()
+	return nil
+}
+
+// replay prints a capture written with run -record as if it came live.
+func replay(args []string) error {
+	fs := flag.NewFlagSet("replay", flag.ExitOnError)
+	in := fs.String("i", "capture.txt", "capture file")
+	speed := fs.Float64("speed", 1, "replay speed, 0 for as fast as possible")
+	fs.Parse(args)
+
+	f, err := os.Open(*in)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	dc := NewDanikorTCPConnection("", printData, WithErrorCallBack(func(err error) {
+		fmt.Println("Error:", err)
+	}))
+	return dc.Replay(context.Background(), f, *speed)
 }
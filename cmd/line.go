@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	. "github.com/linexjlin/danikor"
+)
+
+// line supervises every controller of a line and prints their results.
+func line(args []string) error {
+	fs := flag.NewFlagSet("line", flag.ExitOnError)
+	config := fs.String("config", "stations.json", `station list, e.g. [{"id": "op10", "address": "192.168.2.5:5000"}]`)
+	every := fs.Duration("health", time.Minute, "how often to print the health of every station")
+	fs.Parse(args)
+
+	f, err := os.Open(*config)
+	if err != nil {
+		return err
+	}
+	stations, err := ReadStations(f)
+	f.Close()
+	if err != nil {
+		return fmt.Errorf("%s: %w", *config, err)
+	}
+
+	var m *Manager
+	for i := range stations {
+		id := stations[i].ID
+		// subscribe on the first connect, Run restores it after a reconnect
+		stations[i].Options = append(stations[i].Options, WithStateCallBack(func(s ConnState) {
+			if s == StateConnected {
+				if _, err := m.Station(id).SubscribeResultData(context.Background()); err != nil {
+					fmt.Printf("%s: subscribe: %v\n", id, err)
+				}
+			}
+		}))
+	}
+	m, err = NewManager(stations)
+	if err != nil {
+		return err
+	}
+	defer m.Close()
+
+	events, cancel := m.Events(WithBuffer(256))
+	defer cancel()
+	go func() {
+		for ev := range events {
+			if cycle, ok := ev.Event.(*TighteningCycle); ok && cycle.Result != nil {
+				r := cycle.Result
+				fmt.Printf("%s: %s %.3f N·m %.1f° %s\n", ev.Station, r.ShowFinalStatus(), r.FinalTorqueValue, r.FinalAngleFinal, r.ShowNgCode())
+			}
+		}
+	}()
+	go func() {
+		for range time.Tick(*every) {
+			for _, h := range m.Health() {
+				fmt.Printf("%s %s: %s since %s, last result %s, last error %v\n",
+					h.Station, h.Address, h.State, h.Since.Format(time.TimeOnly), h.LastResult.Format(time.TimeOnly), h.LastError)
+			}
+		}
+	}()
+	return m.Run(context.Background())
+}
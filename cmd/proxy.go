@@ -0,0 +1,43 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"net"
+	"strings"
+
+	. "github.com/linexjlin/danikor"
+)
+
+// proxy shares one controller session among many clients.
+func proxy(args []string) error {
+	fs := flag.NewFlagSet("proxy", flag.ExitOnError)
+	addr := fs.String("addr", defaultAddr, "controller address")
+	listen := fs.String("listen", ":5000", "address clients connect to")
+	master := fs.String("master", "", "host of the client allowed to write, none for read only")
+	writable := fs.String("writable", strings.Join(DefaultProxyWritable, ","), "comma separated MIDs the master may write")
+	fs.Parse(args)
+
+	var p *Proxy
+	dc := NewDanikorTCPConnection(*addr, nil,
+		WithErrorCallBack(func(err error) {
+			fmt.Println("Error:", err)
+		}),
+		WithStateCallBack(func(s ConnState) {
+			fmt.Println("upstream:", s)
+			if s == StateConnected {
+				if err := p.Subscribe(context.Background()); err != nil {
+					fmt.Println("subscribe:", err)
+				}
+			}
+		}))
+	p = NewProxy(dc, WithMaster(*master), WithWritable(strings.Split(*writable, ",")...))
+
+	l, err := net.Listen("tcp", *listen)
+	if err != nil {
+		return err
+	}
+	go dc.Run(context.Background())
+	return p.Serve(l)
+}
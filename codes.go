@@ -0,0 +1,110 @@
+package danikor
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// FinalStatus is the 00011 field of a tightening result.
+type FinalStatus int
+
+const (
+	FinalStatusUndefined FinalStatus = 0 // 无定意
+	FinalStatusOK        FinalStatus = 1 // OK，拧紧合格
+	FinalStatusNG        FinalStatus = 2 // NG，拧紧不合格
+)
+
+func (s FinalStatus) OK() bool { return s == FinalStatusOK }
+func (s FinalStatus) NG() bool { return s == FinalStatusNG }
+
+func parseFinalStatus(value string) (FinalStatus, error) {
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return FinalStatusUndefined, fmt.Errorf("%w: final status %q", ErrBadValue, value)
+	}
+	return FinalStatus(n), nil
+}
+
+// NgCode is the 00012 field of a tightening result, a byte sent as two hex
+// digits: 0x00 none, 0x01..0x04 final torque/angle out of window, 0xn1 and
+// 0xn2 torque out of window in stage n, 0x90 total time exceeded.
+type NgCode uint8
+
+// NgKind is what went wrong, see NgCode.Reason.
+type NgKind int
+
+const (
+	NgNone NgKind = iota
+	NgTorqueHigh
+	NgTorqueLow
+	NgAngleHigh
+	NgAngleLow
+	NgOvertime
+	NgUnknown
+)
+
+// NgReason is a decoded NgCode. Stage is 0 for the final values and for
+// codes that are not about a single stage.
+type NgReason struct {
+	Kind  NgKind
+	Stage int
+}
+
+// Reason decodes the code into what went wrong and in which stage.
+func (c NgCode) Reason() NgReason {
+	switch c {
+	case 0x00:
+		return NgReason{Kind: NgNone}
+	case 0x01:
+		return NgReason{Kind: NgTorqueHigh}
+	case 0x02:
+		return NgReason{Kind: NgTorqueLow}
+	case 0x03:
+		return NgReason{Kind: NgAngleHigh}
+	case 0x04:
+		return NgReason{Kind: NgAngleLow}
+	case 0x90:
+		return NgReason{Kind: NgOvertime}
+	}
+	stage := int(c >> 4)
+	if stage >= 1 && stage <= 9 {
+		switch c & 0x0F {
+		case 0x1:
+			return NgReason{Kind: NgTorqueHigh, Stage: stage}
+		case 0x2:
+			return NgReason{Kind: NgTorqueLow, Stage: stage}
+		}
+	}
+	return NgReason{Kind: NgUnknown}
+}
+
+func parseNgCode(value string) (NgCode, error) {
+	n, err := strconv.ParseUint(value, 16, 8)
+	if err != nil {
+		return 0, fmt.Errorf("%w: ng code %q", ErrBadValue, value)
+	}
+	return NgCode(n), nil
+}
+
+// StageStatus is the 01n1 field of a tightening result, the outcome of
+// stage n.
+type StageStatus int
+
+const (
+	StageUndefined  StageStatus = 0 // 无定意
+	StageOK         StageStatus = 1 // OK
+	StageTorqueHigh StageStatus = 2 // 扭矩过大
+	StageTorqueLow  StageStatus = 3 // 扭矩过小
+	StageAngleHigh  StageStatus = 4 // 角度过大
+	StageAngleLow   StageStatus = 5 // 角度过小
+	StageTimeLong   StageStatus = 6 // 时间过长
+	StageTimeShort  StageStatus = 7 // 时间过短
+)
+
+func parseStageStatus(value string) (StageStatus, error) {
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return StageUndefined, fmt.Errorf("%w: stage status %q", ErrBadValue, value)
+	}
+	return StageStatus(n), nil
+}
@@ -0,0 +1,146 @@
+package danikor
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Curve is one complete tightening curve stitched together from the 0203
+// fragments between IsCurveStart and IsCurveEnd.
+type Curve struct {
+	SampleFrequency string // raw 0101 value, e.g. "5,0"
+	Pset            string
+	Torque          []float64
+	Angle           []float64
+	// Time is the time of each sample in seconds since the curve start,
+	// derived from SampleInterval. It is nil when the interval is unknown.
+	Time           []float64
+	SampleInterval time.Duration
+}
+
+// TighteningCycle pairs a complete curve with the 0202 result that follows
+// it. Either side is nil when the controller did not send it, e.g. when only
+// one of the two is subscribed.
+type TighteningCycle struct {
+	Curve  *Curve
+	Result *DanitorTorqueResult
+}
+
+// sampleInterval reads the sampling period from a 0101 value. The first
+// field is taken as the sample rate in units of 100 Hz: the controller in
+// our captures sends "5,0" with about 1440 samples for a tightening whose
+// result reports 3 s, which is 500 Hz, not a 5 ms period.
+func sampleInterval(sampleFrequency string) time.Duration {
+	first, _, _ := strings.Cut(sampleFrequency, ",")
+	rate, err := strconv.ParseFloat(first, 64)
+	if err != nil || rate <= 0 {
+		return 0
+	}
+	return time.Duration(float64(time.Second) / (rate * 100))
+}
+
+// CycleAssembler turns the stream of pushed frames into complete curves and
+// tightening cycles. The connection runs one for its Cycles and
+// CompleteCurves subscriptions; it can also be fed directly, e.g. from a
+// capture. It is safe for concurrent use.
+type CycleAssembler struct {
+	mu       sync.Mutex
+	building *Curve // curve whose end fragment has not arrived yet
+	pending  *Curve // complete curve waiting for its result
+}
+
+// Add feeds one frame. It returns the curve this frame completed, if any,
+// and the tightening cycle it completed, if any. A cycle completes when its
+// result arrives, or when the next curve completes without a result in
+// between.
+func (ca *CycleAssembler) Add(ansData AnsData) (*Curve, *TighteningCycle) {
+	if ansData.AnsMode != ModeTransmit {
+		return nil, nil
+	}
+	ca.mu.Lock()
+	defer ca.mu.Unlock()
+
+	switch ansData.MID {
+	case "0202":
+		if ansData.TorqueResult == nil {
+			return nil, nil
+		}
+		cycle := &TighteningCycle{Curve: ca.pending, Result: ansData.TorqueResult}
+		ca.pending = nil
+		return nil, cycle
+
+	case "0203":
+		fragment := ansData.Torque
+		if fragment.IsCurveStart {
+			// a new start drops a curve that never ended
+			ca.building = &Curve{
+				SampleFrequency: fragment.SampleFrequency,
+				Pset:            fragment.Pset,
+				SampleInterval:  sampleInterval(fragment.SampleFrequency),
+			}
+		}
+		if ca.building == nil {
+			// joined in the middle of a curve
+			return nil, nil
+		}
+		ca.building.Torque = append(ca.building.Torque, fragment.Torque...)
+		ca.building.Angle = append(ca.building.Angle, fragment.Angle...)
+		if !fragment.IsCurveEnd {
+			return nil, nil
+		}
+
+		curve := ca.building
+		ca.building = nil
+		if curve.SampleInterval > 0 {
+			curve.Time = make([]float64, len(curve.Torque))
+			for i := range curve.Time {
+				curve.Time[i] = float64(i) * curve.SampleInterval.Seconds()
+			}
+		}
+
+		var cycle *TighteningCycle
+		if ca.pending != nil {
+			cycle = &TighteningCycle{Curve: ca.pending}
+		}
+		ca.pending = curve
+		return curve, cycle
+	}
+	return nil, nil
+}
+
+// InProgress reports whether a curve has started and not ended yet.
+func (ca *CycleAssembler) InProgress() bool {
+	ca.mu.Lock()
+	defer ca.mu.Unlock()
+	return ca.building != nil
+}
+
+// Reset drops partial state, e.g. after the link was lost mid curve.
+func (ca *CycleAssembler) Reset() {
+	ca.mu.Lock()
+	ca.building = nil
+	ca.pending = nil
+	ca.mu.Unlock()
+}
+
+// CompleteCurves subscribes to whole tightening curves, each delivered once
+// its end fragment arrived.
+func (dc *DanikorTCPConnection) CompleteCurves(opts ...SubscribeOption) (<-chan *Curve, func()) {
+	accept := func(ev any) bool {
+		_, ok := ev.(*Curve)
+		return ok
+	}
+	return subscribe(&dc.hub, accept, func(ev any) *Curve { return ev.(*Curve) }, opts)
+}
+
+// Cycles subscribes to tightening cycles: a complete curve paired with the
+// 0202 result that follows it.
+func (dc *DanikorTCPConnection) Cycles(opts ...SubscribeOption) (<-chan *TighteningCycle, func()) {
+	accept := func(ev any) bool {
+		_, ok := ev.(*TighteningCycle)
+		return ok
+	}
+	return subscribe(&dc.hub, accept, func(ev any) *TighteningCycle { return ev.(*TighteningCycle) }, opts)
+}
@@ -0,0 +1,56 @@
+package danikor
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestCycleAssembler(t *testing.T) {
+	fragment := func(start, end bool, torque, angle []float64) AnsData {
+		return AnsData{AnsMode: ModeTransmit, MID: "0203", Torque: DanitorTorque{
+			SampleFrequency: "5,0", Pset: "2", IsCurveStart: start, IsCurveEnd: end, Torque: torque, Angle: angle,
+		}}
+	}
+	result := AnsData{AnsMode: ModeTransmit, MID: "0202", TorqueResult: &DanitorTorqueResult{FinalStatus: FinalStatusOK}}
+
+	var ca CycleAssembler
+	steps := []AnsData{
+		fragment(false, false, []float64{9}, []float64{9}), // tail of a curve we joined late
+		fragment(true, false, []float64{0}, []float64{0}),
+		fragment(false, false, []float64{0.1, 0.2}, []float64{10, 20}),
+		fragment(false, true, []float64{0.3}, []float64{30}),
+	}
+	var curve *Curve
+	for i, step := range steps {
+		c, cycle := ca.Add(step)
+		if cycle != nil {
+			t.Fatalf("step %d: unexpected cycle", i)
+		}
+		if c != nil {
+			curve = c
+		}
+	}
+	want := &Curve{
+		SampleFrequency: "5,0",
+		Pset:            "2",
+		Torque:          []float64{0, 0.1, 0.2, 0.3},
+		Angle:           []float64{0, 10, 20, 30},
+		Time:            []float64{0, 0.002, 0.004, 0.006},
+		SampleInterval:  2 * time.Millisecond, // 500 Hz
+	}
+	if !reflect.DeepEqual(curve, want) {
+		t.Fatalf("got curve %+v, want %+v", curve, want)
+	}
+
+	if _, cycle := ca.Add(result); cycle == nil || cycle.Curve != curve || cycle.Result != result.TorqueResult {
+		t.Fatalf("got cycle %+v", cycle)
+	}
+
+	// a curve without a result is flushed when the next one completes
+	ca.Add(fragment(true, true, []float64{1}, []float64{1}))
+	_, cycle := ca.Add(fragment(true, true, []float64{2}, []float64{2}))
+	if cycle == nil || cycle.Result != nil || cycle.Curve.Torque[0] != 1 {
+		t.Fatalf("got cycle %+v", cycle)
+	}
+}
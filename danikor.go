@@ -1,185 +1,439 @@
 package danikor
 
 import (
-	"encoding/hex"
-	"encoding/json"
+	"context"
+	"errors"
 	"fmt"
 	"net"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
+// DefaultTimeout is how long a command waits for its ack when the context
+// passed to it has no deadline.
+const DefaultTimeout = 3 * time.Second
+
+// DanikorTCPConnection is a session with one controller. Its methods are
+// safe for concurrent use: commands may be issued from any goroutine while
+// StartReceiveData or Run is active, including from receiveCallBack, the
+// error callback and subscribers. Those run one at a time, in the order the
+// frames arrived, on a goroutine separate from the reader; while one of
+// them blocks, later frames wait for it but acks of commands do not.
 type DanikorTCPConnection struct {
-	address         string
-	conn            net.Conn
+	address        string
+	timeout        time.Duration
+	connectTimeout time.Duration
+	backoff        backoff
+	maxAttempts    int
+	dialErrorHook  func(attempt int, err error)
+
+	heartbeatInterval  time.Duration
+	heartbeatMaxMissed int
+	heartbeatMID       string
+
 	receiveCallBack func(AnsData)
+	errorCallBack   func(error)
+	stateCallBack   func(ConnState)
+	localizer       Localizer
+	logger          Logger
+	psetLayout      PsetLayout
+	toolMID         string
+	motionLayout    MotionLayout
+	toolFailSafe    bool
+	recorder        *CaptureWriter
+
+	// mu guards the fields below. writeMu serializes frames on the wire,
+	// the reader goroutine started by attach is the only one reading.
+	mu      sync.Mutex
+	writeMu sync.Mutex
+	conn    net.Conn
+	done    chan struct{} // closed when the reader of conn exits
+	drained chan struct{} // closed once everything conn received is delivered
+	readErr error         // why the reader exited
+	pending map[string][]chan AnsData
+	state   ConnState
+	session session
+	tool    ToolState // as known on conn
+
+	hub       hub
+	assembler CycleAssembler
+	delivery  deliveryQueue // runs callbacks and subscriptions off the reader
 }
 
-func NewDanikorTCPConnection(addr string, receiveCallBack func(AnsData)) *DanikorTCPConnection {
+func NewDanikorTCPConnection(addr string, receiveCallBack func(AnsData), opts ...Option) *DanikorTCPConnection {
 	dc := &DanikorTCPConnection{
 		address:         addr,
+		timeout:         DefaultTimeout,
+		connectTimeout:  DefaultConnectTimeout,
+		backoff:         backoff{min: DefaultMinBackoff, max: DefaultMaxBackoff},
+		heartbeatMID:    DefaultHeartbeatMID,
 		receiveCallBack: receiveCallBack,
+		pending:         make(map[string][]chan AnsData),
+		logger:          nopLogger{},
+		psetLayout:      DefaultPsetLayout,
+		toolMID:         DefaultToolMID,
+		motionLayout:    DefaultMotionLayout,
+	}
+	for _, opt := range opts {
+		opt(dc)
 	}
 	return dc
 }
 
-func (dc *DanikorTCPConnection) Dial() {
-	for {
-		conn, err := net.Dial("tcp", dc.address)
-		if err != nil {
-			fmt.Printf("Failed to dial: %v\n", err)
-			time.Sleep(time.Second)
-		} else {
-			dc.conn = conn
-			break
-		}
+// reportError logs err and hands it to the error callback.
+func (dc *DanikorTCPConnection) reportError(err error) {
+	dc.logger.Error("danikor: error", "addr", dc.address, "err", err)
+	if dc.errorCallBack != nil {
+		dc.errorCallBack(err)
 	}
 }
 
-func showData(data []byte) {
-	// Unmarshal the binary data into the AnsData struct
-	var ansData AnsData
-	if err := ansData.UnmarshalBinary(data); err != nil {
-		panic(err)
+// attach makes conn the current connection and starts its reader.
+// A previous connection is closed.
+func (dc *DanikorTCPConnection) attach(conn net.Conn) {
+	done, drained := make(chan struct{}), make(chan struct{})
+	dc.mu.Lock()
+	old := dc.conn
+	dc.conn = conn
+	dc.done = done
+	dc.drained = drained
+	dc.readErr = nil
+	dc.mu.Unlock()
+	if old != nil {
+		old.Close()
+	}
+	go dc.readLoop(conn, done, drained)
+	if dc.heartbeatInterval > 0 {
+		go dc.heartbeat(conn, done)
 	}
+}
 
-	// Marshal the AnsData struct to JSON
-	jsonData, err := json.Marshal(ansData)
-	if err != nil {
-		panic(err)
+// Close closes the connection. Commands waiting for an ack return ErrClosed.
+func (dc *DanikorTCPConnection) Close() error {
+	dc.mu.Lock()
+	conn := dc.conn
+	dc.mu.Unlock()
+	if conn == nil {
+		return nil
 	}
-	fmt.Println(string(jsonData))
+	return conn.Close()
 }
 
-func parseData(data []byte) AnsData {
+func parseData(data []byte) (AnsData, error) {
 	// Unmarshal the binary data into the AnsData struct
 	var ansData AnsData
 	if err := ansData.UnmarshalBinary(data); err != nil {
-		panic(err)
+		return ansData, &ProtocolError{Frame: data, Err: err}
 	}
-	return ansData
+	return ansData, nil
 }
 
-func (dc *DanikorTCPConnection) Establish() {
-	data := []byte{0x02, 0x00, 0x00, 0x00, 0x05, 0x52, 0x30, 0x30, 0x30, 0x31, 0x03} //mid 001 建立通信数据包
+// readLoop is the only reader of conn, it dispatches every frame read.
+// Callbacks and subscriptions run on the delivery queue, in order.
+func (dc *DanikorTCPConnection) readLoop(conn net.Conn, done, drained chan struct{}) {
+	reader := NewFrameReader(conn)
+	if dc.recorder != nil {
+		reader.discard = func(b []byte) { dc.record(Discarded, b) }
+	}
+	for {
+		frame, err := reader.ReadFrame()
+		if err != nil {
+			dc.mu.Lock()
+			dc.readErr = err
+			dc.tool = ToolUnknown
+			close(done)
+			dc.mu.Unlock()
+			dc.delivery.push(func() {
+				dc.assembler.Reset()
+				dc.reportError(err)
+				close(drained)
+			})
+			return
+		}
+		dc.logger.Debug("danikor: frame received", "addr", dc.address, "frame", hexFrame(frame))
+		dc.record(Received, frame)
+		dc.dispatch(frame, dc.delivery.push)
+	}
+}
 
-	_, err := dc.conn.Write(data)
+// dispatch parses one received frame. Acks go straight to the command
+// waiting for them; handing everything else to receiveCallBack and the
+// subscribers, and reporting parse errors, is passed to deliver.
+func (dc *DanikorTCPConnection) dispatch(frame []byte, deliver func(func())) {
+	ansData, err := parseData(frame)
 	if err != nil {
-		fmt.Println("Error sending data:", err)
-		return
+		deliver(func() { dc.reportError(err) })
+		if !errors.Is(err, ErrBadValue) {
+			return
+		}
+		// the frame itself is sound, deliver what could be parsed
+	}
+	if ansData.TorqueResult != nil {
+		ansData.TorqueResult.localizer = dc.localizer
 	}
 
-	// Receive and print the response
-	response := make([]byte, 1024)
-	n, err := dc.conn.Read(response)
-	if err != nil {
-		fmt.Println("Error receiving response:", err)
+	if ansData.AnsMode == ModeAck && dc.deliverAck(ansData) {
 		return
 	}
-	showData(response[:n])
+	deliver(func() { dc.deliver(ansData) })
 }
 
-func (dc *DanikorTCPConnection) SubscribeResultData() {
-	data := []byte{0x02, 0x00, 0x00, 0x00, 0x05, 0x52, 0x30, 0x32, 0x30, 0x32, 0x03} //mid 0203 实时曲线数据
+// deliver hands a frame that is not the ack of a command to receiveCallBack
+// and the subscribers.
+func (dc *DanikorTCPConnection) deliver(ansData AnsData) {
+	if dc.receiveCallBack != nil {
+		dc.receiveCallBack(ansData)
+	}
+	dc.publish(ansData)
 
-	_, err := dc.conn.Write(data)
-	if err != nil {
-		fmt.Println("Error sending data:", err)
-		return
+	curve, cycle := dc.assembler.Add(ansData)
+	if curve != nil {
+		dc.publish(curve)
+	}
+	if cycle != nil {
+		dc.publish(cycle)
 	}
+}
 
-	// Receive and print the response
-	response := make([]byte, 1024)
-	n, err := dc.conn.Read(response)
-	if err != nil {
-		fmt.Println("Error receiving response:", err)
-		return
+// deliveryQueue runs funcs one at a time, in the order they were pushed, on
+// a goroutine of its own that only lives while there is work. The reader
+// pushes callbacks here instead of running them, so it keeps routing acks
+// while a callback waits for a command. The queue is unbounded: a callback
+// that never returns holds back every later frame, not the reader.
+type deliveryQueue struct {
+	mu      sync.Mutex
+	items   []func()
+	running bool
+}
+
+func (q *deliveryQueue) push(f func()) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.items = append(q.items, f)
+	if !q.running {
+		q.running = true
+		go q.run()
 	}
-	fmt.Println("SubscribeResultData receive:", hex.EncodeToString(response[:n]))
-	showData(response[:n])
 }
 
-func (dc *DanikorTCPConnection) SubscribeRealTimeData() {
-	data := []byte{0x02, 0x00, 0x00, 0x00, 0x05, 0x52, 0x30, 0x32, 0x30, 0x33, 0x03} //mid 0203 实时曲线数据
+func (q *deliveryQueue) run() {
+	for {
+		q.mu.Lock()
+		if len(q.items) == 0 {
+			q.running = false
+			q.mu.Unlock()
+			return
+		}
+		f := q.items[0]
+		q.items[0] = nil
+		q.items = q.items[1:]
+		q.mu.Unlock()
+		f()
+	}
+}
 
-	_, err := dc.conn.Write(data)
-	if err != nil {
-		fmt.Println("Error sending data:", err)
-		return
+// deliverAck passes ack to the oldest command waiting on its MID.
+func (dc *DanikorTCPConnection) deliverAck(ack AnsData) bool {
+	dc.mu.Lock()
+	defer dc.mu.Unlock()
+	waiters := dc.pending[ack.MID]
+	if len(waiters) == 0 {
+		return false
 	}
+	waiters[0] <- ack
+	if len(waiters) == 1 {
+		delete(dc.pending, ack.MID)
+	} else {
+		dc.pending[ack.MID] = waiters[1:]
+	}
+	return true
+}
 
-	// Receive and print the response
-	response := make([]byte, 1024)
-	n, err := dc.conn.Read(response)
-	if err != nil {
-		fmt.Println("Error receiving response:", err)
-		return
+func (dc *DanikorTCPConnection) cancelWait(mid string, ch chan AnsData) {
+	dc.mu.Lock()
+	defer dc.mu.Unlock()
+	waiters := dc.pending[mid]
+	for i, w := range waiters {
+		if w == ch {
+			waiters = append(waiters[:i:i], waiters[i+1:]...)
+			break
+		}
 	}
-	showData(response[:n])
+	if len(waiters) == 0 {
+		delete(dc.pending, mid)
+	} else {
+		dc.pending[mid] = waiters
+	}
+}
+
+// Do writes req to the controller and waits for the 'A' frame with the same
+// MID. It can be used for any MID the controller supports.
+//
+// If ctx has no deadline the connection timeout applies. A timeout returns
+// an error wrapping context.DeadlineExceeded, a rejected request one
+// wrapping ErrNak together with the ack.
+func (dc *DanikorTCPConnection) Do(ctx context.Context, req *Request) (AnsData, error) {
+	ack, _, err := dc.do(ctx, req)
+	return ack, err
 }
 
-func (dc *DanikorTCPConnection) ForwardTurn() {
-	data := []byte{0x02, 0x00, 0x00, 0x00, 0x0A, 0x57, 0x30, 0x33, 0x30, 0x31, 0x30, 0x31, 0x3D, 0x31, 0x3B, 0x03} //mid 正转
-	_, err := dc.conn.Write(data)
+// do is Do, also reporting whether the frame went out, i.e. whether the
+// controller may act on req even though err is set.
+func (dc *DanikorTCPConnection) do(ctx context.Context, req *Request) (AnsData, bool, error) {
+	data, err := req.MarshalBinary()
 	if err != nil {
-		fmt.Println("Error sending data:", err)
-		return
+		return AnsData{}, false, err
+	}
+	if _, ok := ctx.Deadline(); !ok && dc.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, dc.timeout)
+		defer cancel()
 	}
 
-	// Receive and print the response
-	response := make([]byte, 1024)
-	n, err := dc.conn.Read(response)
-	if err != nil {
-		fmt.Println("Error receiving response:", err)
-		return
+	ch := make(chan AnsData, 1)
+	dc.mu.Lock()
+	conn, done := dc.conn, dc.done
+	if conn == nil {
+		dc.mu.Unlock()
+		return AnsData{}, false, ErrNotConnected
+	}
+	dc.pending[req.MID] = append(dc.pending[req.MID], ch)
+	dc.mu.Unlock()
+
+	if err := dc.write(ctx, conn, data); err != nil {
+		dc.cancelWait(req.MID, ch)
+		return AnsData{}, false, err
+	}
+
+	select {
+	case ack := <-ch:
+		if isNak(ack) {
+			return ack, true, fmt.Errorf("%w: %s: %s", ErrNak, req, ack.Data)
+		}
+		return ack, true, nil
+	case <-done:
+		dc.cancelWait(req.MID, ch)
+		dc.mu.Lock()
+		readErr := dc.readErr
+		dc.mu.Unlock()
+		return AnsData{}, true, fmt.Errorf("%w: %s: %v", ErrClosed, req, readErr)
+	case <-ctx.Done():
+		dc.cancelWait(req.MID, ch)
+		return AnsData{}, true, fmt.Errorf("danikor: %s: %w", req, ctx.Err())
 	}
-	showData(response[:n])
 }
 
-func (dc *DanikorTCPConnection) StartReceiveData() {
-	response := make([]byte, 1024)
-	// Continuously receive and print data
-	for {
-		n, err := dc.conn.Read(response)
-		if err != nil {
-			fmt.Println("Error receiving response:", err)
-			return
+// ReadParams reads keys of mid with an 'R' request and returns the key=value
+// entries of the answer. Every requested key must be in the answer; with no
+// keys the whole answer is returned.
+func (dc *DanikorTCPConnection) ReadParams(ctx context.Context, mid string, keys ...string) (Params, error) {
+	req := NewRequest(ModeRead, mid)
+	for _, key := range keys {
+		req.Params = append(req.Params, Param{Key: key})
+	}
+	ack, err := dc.Do(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	for _, key := range keys {
+		if _, ok := ack.Params.Get(key); !ok {
+			return ack.Params, fmt.Errorf("%w: %s in answer to %s", ErrMissingParam, key, req)
 		}
-		//showData(response[:n])
-		//fmt.Println(hex.EncodeToString(response[:n]))
-		ansData := parseData(response[:n])
+	}
+	return ack.Params, nil
+}
 
-		dc.receiveCallBack(ansData)
-		//fmt.Println("xxxx", hex.EncodeToString(response[:n]))
+// WriteParams writes values, keyed by parameter key, to mid with a 'W'
+// request. Keys are sent in sorted order. A rejected write returns an error
+// wrapping ErrNak.
+func (dc *DanikorTCPConnection) WriteParams(ctx context.Context, mid string, values map[string]string) error {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	req := NewRequest(ModeWrite, mid)
+	for _, key := range keys {
+		req.Params = append(req.Params, Param{Key: key, Value: values[key]})
 	}
+	_, err := dc.Do(ctx, req)
+	return err
 }
 
-func (dc *DanikorTCPConnection) ChosePset(pset int) error {
-	if pset < 1 || pset > 8 {
-		return fmt.Errorf("pset number not support %d", pset)
+// write sends one whole frame. Writes are serialized so frames of commands
+// issued from different goroutines never interleave on the wire.
+func (dc *DanikorTCPConnection) write(ctx context.Context, conn net.Conn, data []byte) error {
+	dc.writeMu.Lock()
+	defer dc.writeMu.Unlock()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetWriteDeadline(deadline)
+		defer conn.SetWriteDeadline(time.Time{})
 	}
-	str := fmt.Sprintf("W010301=%d;", pset)
-	head := "020000000A"
-	tail := "03"
-	hexStr := head + fmt.Sprintf("%x", str) + tail
-	data, err := hex.DecodeString(strings.ReplaceAll(hexStr, " ", ""))
-	if err != nil {
-		return err
+	dc.logger.Debug("danikor: frame sent", "addr", dc.address, "frame", hexFrame(data))
+	_, err := conn.Write(data)
+	if err == nil {
+		dc.record(Sent, data)
 	}
-	_, err = dc.conn.Write(data)
-	if err != nil {
-		fmt.Println("Error sending data:", err)
-		return err
+	return err
+}
+
+func isNak(ack AnsData) bool {
+	return strings.HasPrefix(string(ack.Data), "NAK")
+}
+
+func (dc *DanikorTCPConnection) Establish(ctx context.Context) (AnsData, error) {
+	return dc.Do(ctx, NewRequest(ModeRead, "0001")) //mid 001 建立通信数据包
+}
+
+func (dc *DanikorTCPConnection) SubscribeResultData(ctx context.Context) (AnsData, error) {
+	return dc.subscribe(ctx, "0202") //mid 0202 拧紧结果数据
+}
+
+func (dc *DanikorTCPConnection) SubscribeRealTimeData(ctx context.Context) (AnsData, error) {
+	return dc.subscribe(ctx, "0203") //mid 0203 实时曲线数据
+}
+
+func (dc *DanikorTCPConnection) subscribe(ctx context.Context, mid string) (AnsData, error) {
+	ack, err := dc.Do(ctx, NewRequest(ModeRead, mid))
+	if err == nil {
+		dc.rememberSubscription(mid)
+	}
+	return ack, err
+}
+
+// ForwardTurn starts tightening with the selected pset. Like every motion
+// command it fails with ErrCycleInProgress during a cycle unless forced.
+func (dc *DanikorTCPConnection) ForwardTurn(ctx context.Context, opts ...MotionOption) (AnsData, error) {
+	if err := dc.checkMotion(opts); err != nil {
+		return AnsData{}, err
 	}
+	l := dc.motionLayout
+	return dc.Do(ctx, NewRequest(ModeWrite, l.MID, Param{"01", l.Forward})) //mid 正转
+}
+
+// StartReceiveData blocks until the connection is lost and everything it
+// received has been handed to receiveCallBack and the subscribers. Frames
+// are read by the goroutine started in Dial.
+func (dc *DanikorTCPConnection) StartReceiveData() {
+	dc.mu.Lock()
+	drained := dc.drained
+	dc.mu.Unlock()
+	if drained != nil {
+		<-drained
+	}
+}
 
-	// Receive and print the response
-	response := make([]byte, 1024)
-	n, e := dc.conn.Read(response)
-	if e != nil {
-		fmt.Println("Error receiving response:", e)
-		return e
+func (dc *DanikorTCPConnection) ChosePset(ctx context.Context, pset int) (AnsData, error) {
+	if err := checkPset(pset); err != nil {
+		return AnsData{}, err
+	}
+	ack, err := dc.Do(ctx, NewRequest(ModeWrite, "0103", Param{"01", strconv.Itoa(pset)}))
+	if err == nil {
+		dc.rememberPset(pset)
 	}
-	fmt.Printf("%x", response[:n])
-	showData(response[:n])
-	return nil
+	return ack, err
 }
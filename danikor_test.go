@@ -1,10 +1,15 @@
 package danikor
 
 import (
+	"context"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"net"
+	"reflect"
+	"sort"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 )
@@ -29,116 +34,661 @@ func TestDanikorTCPConnection_Dial(t *testing.T) {
 
 	// 启动一个goroutine来接受连接
 	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			t.Errorf("Failed to accept connection: %v", err)
+			return
+		}
+		defer conn.Close()
+
+		recData := make([]byte, 1024)
 		for {
-			conn, err := listener.Accept()
+			n, err := conn.Read(recData)
 			if err != nil {
-				t.Errorf("Failed to accept connection: %v", err)
+				fmt.Println("Error receiving recData:", err)
 				return
 			}
+			fmt.Println("server receive package:", hex.EncodeToString(recData[:n]))
+			switch hex.EncodeToString(recData[:n]) {
+			case "0200000005523030303103", "0200000005523032303303", "0200000005523032303203", "020000000a573031303330313d313b03": //estabish package, subscribe realtime data package, subscribe result package,chose pset package
+				fmt.Println("mid 001 建立通信数据包, or mid 0203 订阅实时曲线数据")
+				rspDataStr := "020000000841" + hex.EncodeToString(recData[6:10]) + "41434b03" // ack with the MID of the request
 
-			recData := make([]byte, 1024)
-			for {
-				n, err := conn.Read(recData)
-				if err != nil {
-					fmt.Println("Error receiving recData:", err)
+				if err = sendHexString(conn, rspDataStr); err != nil {
 					return
 				}
-				fmt.Println("server receive package:", hex.EncodeToString(recData[:n]))
-				switch hex.EncodeToString(recData[:n]) {
-				case "0200000005523030303103", "0200000005523032303303", "0200000005523032303203", "020000000A573031303330313d313b03": //estabish package, subscribe realtime data package, subscribe result package,chose pset package
-					fmt.Println("mid 001 建立通信数据包, or mid 0203 订阅实时曲线数据")
-					rspDataStr := "0200000008413030303141434b03"
-
-					if err = sendHexString(conn, rspDataStr); err != nil {
-						return
-					}
-				case "020000000a573033303130313d313b03":
-					fmt.Println("mid 正转")
-					d_0 := "0200000008413033303141434b03"
-					d_1 := "02000000395430323033303130313d352c303b303130323d313b303230313d303b303230323d313b303330313d302e3030303b303330323d302e3030303b03"
-					d_2 := "02000001665430323033303130313d352c303b303130323d313b303230313d303b303230323d303b303330313d302e3030372c302e3030372c302e3030372c302e3031302c302e3030392c302e3030392c302e3031302c302e3031332c302e3031302c302e3030372c302e3030372c302e3030372c302e3030392c302e3030362c302e3030312c302e3030322c302e3030322c302e3030332c302e3030332c302e3030312c302e3030322c302e3030352c302e3030352c302e3030362c302e3030353b303330323d302e3030302c302e3030302c302e3030302c312e3134362c312e3731392c322e3836352c342e3031312c342e3031312c352e3733302c362e3837352c382e3539342c392e3734302c31312e3435392c31312e3435392c31322e3630352c31332e3137382c31342e3332342c31352e3437302c31362e3034332c31362e3034332c31362e3631362c31372e3736322c31382e3333352c31382e3930382c32302e3035343b03"
-					d_3 := "02000001725430323033303130313d352c303b303130323d313b303230313d303b303230323d303b303330313d302e3030302c302e3030332c302e3030342c302e3030302c302e3030312c302e3030312c302e3030332c302e3030342c302e3030312c302e3030312c302e3030342c302e3030342c302e3030362c302e3030332c302e3030332c302e3030342c302e3030362c302e3030362c302e3030342c302e3030322c302e3030342c302e3030362c302e3030352c302e3030352c302e3030333b303330323d34312e3235332c34332e3534352c34342e3131382c34352e3236342c34362e3431302c34372e3535352c34382e3132382c34382e3132382c34392e3237342c34392e3834372c35302e3939332c35322e3133392c35322e3731322c35322e3731322c35332e3835382c35352e3030342c35362e3135302c35372e3239362c35372e3836392c35372e3836392c35392e3031352c36302e3136312c36312e3330362c36322e3435322c36332e3032353b03"
-					d_5 := "02000001795430323033303130313d352c303b303130323d313b303230313d303b303230323d303b303330313d302e3030332c302e3030342c302e3030342c302e3030322c302e3030332c302e3030362c302e3030352c302e3030322c302e3030322c302e3030332c302e3030352c302e3030352c302e3030322c302e3030322c302e3030322c302e3030342c302e3030362c302e3030322c302e3030332c302e3030352c302e3030352c302e3030372c302e3030352c302e3030342c302e3030363b303330323d38342e3232352c38362e3531372c38372e3039302c38382e3233352c38382e3233352c38392e3338312c39302e3532372c39312e3130302c39322e3234362c39332e3339322c39332e3339322c39342e3533382c39352e3638342c39362e3235372c39372e3430332c39382e3534392c39382e3534392c39392e3639352c3130302e3236382c3130312e3431342c3130312e3938362c3130332e3133322c3130332e3133322c3130332e3730352c3130342e3835313b03"
-					d_6 := "020000018b5430323033303130313d352c303b303130323d313b303230313d303b303230323d303b303330313d302e3030362c302e3030372c302e3030342c302e3030352c302e3030352c302e3030372c302e3030362c302e3030332c302e3030342c302e3030362c302e3030362c302e3030352c302e3030322c302e3030332c302e3030342c302e3030352c302e3030352c302e3030322c302e3030312c302e3030332c302e3030342c302e3030312c302e3030312c302e3030312c302e3030333b303330323d3130342e3835312c3130372e3134332c3130382e3238392c3130382e3836322c3131302e3030382c3131312e3135342c3131312e3135342c3131322e3330302c3131332e3434362c3131342e3539322c3131352e3733372c3131362e3838332c3131362e3838332c3131372e3435362c3131382e3630322c3131392e3734382c3132302e3839342c3132322e3034302c3132322e3034302c3132332e3138362c3132332e3735392c3132342e3930352c3132362e3035312c3132362e3632342c3132362e3632343b03"
-					d_7 := "020000018b5430323033303130313d352c303b303130323d313b303230313d303b303230323d303b303330313d302e3030332c302e3030322c302e3030322c302e3030332c302e3030352c302e3030352c302e3030332c302e3030312c302e3030322c302e3030342c302e3030322c302e3030322c302e3030302c302e3030302c302e3030332c302e3030332c302e3030312c302e3030312c302e3030332c302e3030352c302e3030362c302e3030342c302e3030342c302e3030342c302e3030363b303330323d3132372e3737302c3132382e3931352c3132392e3438382c3133302e3633342c3133312e3738302c3133322e3932362c3133342e3037322c3133342e3037322c3133352e3231382c3133362e3336342c3133372e3531302c3133382e3038332c3133392e3232392c3133392e3232392c3134302e3337352c3134302e3934382c3134322e3039342c3134322e3636362c3134332e3831322c3134332e3831322c3134342e3338352c3134352e3533312c3134362e3130342c3134372e3235302c3134382e3339363b03"
-					d_47 := "02000001925430323033303130313d352c303b303130323d313b303230313d303b303230323d303b303330313d302e3030352c302e3030322c302e3030322c302e3030342c302e3030362c302e3030332c302e3030312c302e3030322c302e3030322c302e3030342c302e3030322c302e3030302c302e3030312c302e3030342c302e3030342c302e3030332c302e3030312c302e3030322c302e3030342c302e3030352c302e3030352c302e3030322c302e3030332c302e3030352c302e3030363b303330323d3938342e3334312c3938362e3036302c3938372e3230362c3938382e3335322c3938382e3335322c3938392e3439382c3939302e3634342c3939312e3739302c3939322e3933362c3939342e3038322c3939342e3038322c3939352e3232382c3939352e3830312c3939362e3934362c3939382e3039322c3939382e3636352c3939382e3636352c3939392e3831312c313030302e3338342c313030312e3533302c313030322e3637362c313030332e3234392c313030332e3234392c313030342e3339352c313030352e3534313b03"
-					d_59 := "020000010e5430323033303130313d352c303b303130323d313b303230313d313b303230323d303b303330313d302e3030322c302e3030332c302e3030312c302e3030312c302e3030322c302e3030332c302e3030322c302e3030302c302e3030312c302e3030312c302e3030332c302e3030332c302e3030302c302e3030312c302e3030313b303330323d313234332e3839312c313234362e3138332c313234362e3735362c313234372e3930322c313234392e3034382c313234392e3034382c313235302e3139342c313235302e3736372c313235312e3931332c313235332e3035392c313235342e3230342c313235342e3230342c313235342e3737372c313235352e3932332c313235372e3036393b03"
-					r_1 := "02000000da543032303230303031303d302e3031322c302e3030302c332e3030302c313235372e3036393b30303031313d323b30303031323d35323b30313031303d302e3030302c302e3030302c302e3030303b30313031313d313b30313032303d302e3030302c302e3030302c302e3030303b30313032313d313b30313033303d302e3030302c302e3030302c302e3030303b30313033313d313b30313034303d302e3030302c302e3030302c302e3030303b30313034313d313b30313035303d302e3031322c313235372e3036392c332e3030303b30313035313d363b03"
-					m_0 := "020000010e5430323033303130313d352c303b303130323d313b303230313d313b303230323d303b303330313d302e3030322c302e3030332c302e3030312c302e3030312c302e3030322c302e3030332c302e3030322c302e3030302c302e3030312c302e3030312c302e3030332c302e3030332c302e3030302c302e3030312c302e3030313b303330323d313234332e3839312c313234362e3138332c313234362e3735362c313234372e3930322c313234392e3034382c313234392e3034382c313235302e3139342c313235302e3736372c313235312e3931332c313235332e3035392c313235342e3230342c313235342e3230342c313235342e3737372c313235352e3932332c313235372e3036393b03"
-					m_1 := "02000001725430323033303130313d352c303b303130323d313b303230313d303b303230323d303b303330313d302e3030362c302e3030322c302e3030342c302e3030312c302e3030312c302e3030312c302e3030302c302e3030302c302e3030322c302e3030322c302e3030342c302e3030302c302e3030302c302e3030302c302e3030312c302e3030302c302e3030322c302e3030342c302e3030322c302e3030322c302e3030302c302e3030322c302e3030312c302e3030312c302e3030323b303330323d32352e3231302c32362e3335362c32392e3739342c33302e3934302c33312e3531332c33312e3531332c33342e3935302c33352e3532332c33362e3636392c33372e3831352c33382e3936312c33382e3936312c33392e3533342c34302e3638302c34332e3534352c34332e3534352c34342e3639312c34352e3833372c34362e3938332c34372e3535352c34382e3730312c34382e3730312c35312e3536362c35322e3731322c35332e3835383b03"
-					m_3 := "020000017b5430323033303130313d352c303b303130323d313b303230313d303b303230323d303b303330313d302e3030322c302e3030312c302e3030322c302e3030322c302e3030352c302e3030352c302e3030362c302e3030332c302e3030332c302e3030362c302e3030322c302e3030342c302e3030322c302e3030322c302e3030312c302e3030322c302e3030352c302e3030342c302e3030362c302e3030362c302e3030352c302e3030332c302e3030342c302e3030362c302e3030363b303330323d38302e3231342c38312e3933332c38342e3739382c38352e3337312c38362e3531372c38372e3636332c38382e3830382c38382e3830382c38392e3935342c39322e3234362c39352e3131312c39362e3235372c39372e3430332c39372e3937362c39392e3132322c39392e3132322c3130302e3236382c3130332e3133322c3130332e3730352c3130342e3835312c3130352e3939372c3130362e3537302c3130362e3537302c3130372e3731362c3130382e3836323b03"
-					m_4 := "020000017b5430323033303130313d352c303b303130323d313b303230313d303b303230323d303b303330313d302e3030322c302e3030312c302e3030322c302e3030322c302e3030352c302e3030352c302e3030362c302e3030332c302e3030332c302e3030362c302e3030322c302e3030342c302e3030322c302e3030322c302e3030312c302e3030322c302e3030352c302e3030342c302e3030362c302e3030362c302e3030352c302e3030332c302e3030342c302e3030362c302e3030363b303330323d38302e3231342c38312e3933332c38342e3739382c38352e3337312c38362e3531372c38372e3636332c38382e3830382c38382e3830382c38392e3935342c39322e3234362c39352e3131312c39362e3235372c39372e3430332c39372e3937362c39392e3132322c39392e3132322c3130302e3236382c3130332e3133322c3130332e3730352c3130342e3835312c3130352e3939372c3130362e3537302c3130362e3537302c3130372e3731362c3130382e3836323b03"
-					m_5 := "02000001a15430323033303130313d352c303b303130323d313b303230313d303b303230323d303b303330313d302e3030352c302e3030312c302e3030322c302e3030342c302e3030312c302e3030332c302e3030352c302e3030362c302e3030332c302e3030332c302e3030342c302e3030352c302e3030342c302e3030342c302e3030362c302e3030372c302e3030342c302e3030332c302e3030332c302e3030332c302e3030322c302e3030322c302e3030342c302e3030342c302e3030333b303330323d3939352e3232382c3939362e3337342c3939362e3934362c313030302e3338342c313030302e3935372c313030302e3935372c313030322e3130332c313030332e3234392c313030332e3832322c313030342e3936382c313030342e3936382c313030372e3833332c313030382e3937392c313030392e3535322c313031312e3237302c313031312e3237302c313031312e3834332c313031322e3938392c313031342e3133352c313031362e3432372c313031372e3537332c313031382e3731392c313031392e3239322c313032302e3433382c313032312e3538343b03"
-					m_6 := "02000001a45430323033303130313d352c303b303130323d313b303230313d303b303230323d303b303330313d302e3030332c302e3030312c302e3030302c302e3030312c302e3030332c302e3030332c302e3030342c302e3030302c302e3030312c302e3030312c302e3030312c302e3030302c302e3030322c302e3030332c302e3030302c302e3030302c302e3030312c302e3030302c302e3030302c302e3030302c302e3030332c302e3030352c302e3030342c302e3030332c302e3030343b303330323d313032312e3538342c313032322e3733302c313032352e3539342c313032362e3734302c313032372e3331332c313032382e3435392c313032392e3630352c313032392e3630352c313033302e3137382c313033312e3332342c313033342e3736322c313033342e3736322c313033352e3930382c313033372e3035342c313033382e3139392c313033392e3334352c313033392e3931382c313033392e3931382c313034322e3738332c313034332e3335362c313034342e3530322c313034342e3530322c313034352e3037352c313034362e3232312c313034362e3739343b03"
-					m_7 := "02000000965430323033303130313d352c303b303130323d313b303230313d313b303230323d303b303330313d302e3030352c302e3030342c302e3030362c302e3030342c302e3030312c302e3030322c302e3030313b303330323d313234372e3930322c313235302e3139342c313235312e3334302c313235312e3334302c313235322e3438362c313235332e3035392c313235362e3439363b03"
-
-					sendHexString(conn, d_0)
-					time.Sleep(time.Millisecond * 200)
-					sendHexString(conn, d_1)
-					time.Sleep(time.Millisecond * 200)
-					sendHexString(conn, d_2)
-					time.Sleep(time.Millisecond * 200)
-					sendHexString(conn, d_3)
-					time.Sleep(time.Millisecond * 200)
-					sendHexString(conn, d_5)
-					time.Sleep(time.Millisecond * 200)
-					sendHexString(conn, d_6)
-					time.Sleep(time.Millisecond * 200)
-					sendHexString(conn, d_7)
-					time.Sleep(time.Millisecond * 200)
-					sendHexString(conn, d_47)
-					time.Sleep(time.Millisecond * 200)
-					sendHexString(conn, d_59)
-					time.Sleep(time.Millisecond * 200)
-					sendHexString(conn, r_1)
-
-					time.Sleep(time.Second * 5)
-					sendHexString(conn, m_0)
-					time.Sleep(time.Millisecond * 200)
-					sendHexString(conn, m_1)
-					time.Sleep(time.Millisecond * 200)
-					sendHexString(conn, m_3)
-					time.Sleep(time.Millisecond * 200)
-					sendHexString(conn, m_4)
-					time.Sleep(time.Millisecond * 200)
-					sendHexString(conn, m_5)
-					time.Sleep(time.Millisecond * 200)
-					sendHexString(conn, m_6)
-					time.Sleep(time.Millisecond * 200)
-					sendHexString(conn, m_7)
-					time.Sleep(time.Millisecond * 200)
-					sendHexString(conn, r_1)
-				default:
-					fmt.Println("server receive unknown package:", hex.EncodeToString(recData[:n]))
-				}
+			case "020000000a573033303130313d313b03":
+				fmt.Println("mid 正转")
+				d_0 := "0200000008413033303141434b03"
+				d_1 := "02000000395430323033303130313d352c303b303130323d313b303230313d303b303230323d313b303330313d302e3030303b303330323d302e3030303b03"
+				d_2 := "02000001665430323033303130313d352c303b303130323d313b303230313d303b303230323d303b303330313d302e3030372c302e3030372c302e3030372c302e3031302c302e3030392c302e3030392c302e3031302c302e3031332c302e3031302c302e3030372c302e3030372c302e3030372c302e3030392c302e3030362c302e3030312c302e3030322c302e3030322c302e3030332c302e3030332c302e3030312c302e3030322c302e3030352c302e3030352c302e3030362c302e3030353b303330323d302e3030302c302e3030302c302e3030302c312e3134362c312e3731392c322e3836352c342e3031312c342e3031312c352e3733302c362e3837352c382e3539342c392e3734302c31312e3435392c31312e3435392c31322e3630352c31332e3137382c31342e3332342c31352e3437302c31362e3034332c31362e3034332c31362e3631362c31372e3736322c31382e3333352c31382e3930382c32302e3035343b03"
+				d_3 := "02000001725430323033303130313d352c303b303130323d313b303230313d303b303230323d303b303330313d302e3030302c302e3030332c302e3030342c302e3030302c302e3030312c302e3030312c302e3030332c302e3030342c302e3030312c302e3030312c302e3030342c302e3030342c302e3030362c302e3030332c302e3030332c302e3030342c302e3030362c302e3030362c302e3030342c302e3030322c302e3030342c302e3030362c302e3030352c302e3030352c302e3030333b303330323d34312e3235332c34332e3534352c34342e3131382c34352e3236342c34362e3431302c34372e3535352c34382e3132382c34382e3132382c34392e3237342c34392e3834372c35302e3939332c35322e3133392c35322e3731322c35322e3731322c35332e3835382c35352e3030342c35362e3135302c35372e3239362c35372e3836392c35372e3836392c35392e3031352c36302e3136312c36312e3330362c36322e3435322c36332e3032353b03"
+				d_5 := "02000001795430323033303130313d352c303b303130323d313b303230313d303b303230323d303b303330313d302e3030332c302e3030342c302e3030342c302e3030322c302e3030332c302e3030362c302e3030352c302e3030322c302e3030322c302e3030332c302e3030352c302e3030352c302e3030322c302e3030322c302e3030322c302e3030342c302e3030362c302e3030322c302e3030332c302e3030352c302e3030352c302e3030372c302e3030352c302e3030342c302e3030363b303330323d38342e3232352c38362e3531372c38372e3039302c38382e3233352c38382e3233352c38392e3338312c39302e3532372c39312e3130302c39322e3234362c39332e3339322c39332e3339322c39342e3533382c39352e3638342c39362e3235372c39372e3430332c39382e3534392c39382e3534392c39392e3639352c3130302e3236382c3130312e3431342c3130312e3938362c3130332e3133322c3130332e3133322c3130332e3730352c3130342e3835313b03"
+				d_6 := "020000018b5430323033303130313d352c303b303130323d313b303230313d303b303230323d303b303330313d302e3030362c302e3030372c302e3030342c302e3030352c302e3030352c302e3030372c302e3030362c302e3030332c302e3030342c302e3030362c302e3030362c302e3030352c302e3030322c302e3030332c302e3030342c302e3030352c302e3030352c302e3030322c302e3030312c302e3030332c302e3030342c302e3030312c302e3030312c302e3030312c302e3030333b303330323d3130342e3835312c3130372e3134332c3130382e3238392c3130382e3836322c3131302e3030382c3131312e3135342c3131312e3135342c3131322e3330302c3131332e3434362c3131342e3539322c3131352e3733372c3131362e3838332c3131362e3838332c3131372e3435362c3131382e3630322c3131392e3734382c3132302e3839342c3132322e3034302c3132322e3034302c3132332e3138362c3132332e3735392c3132342e3930352c3132362e3035312c3132362e3632342c3132362e3632343b03"
+				d_7 := "020000018b5430323033303130313d352c303b303130323d313b303230313d303b303230323d303b303330313d302e3030332c302e3030322c302e3030322c302e3030332c302e3030352c302e3030352c302e3030332c302e3030312c302e3030322c302e3030342c302e3030322c302e3030322c302e3030302c302e3030302c302e3030332c302e3030332c302e3030312c302e3030312c302e3030332c302e3030352c302e3030362c302e3030342c302e3030342c302e3030342c302e3030363b303330323d3132372e3737302c3132382e3931352c3132392e3438382c3133302e3633342c3133312e3738302c3133322e3932362c3133342e3037322c3133342e3037322c3133352e3231382c3133362e3336342c3133372e3531302c3133382e3038332c3133392e3232392c3133392e3232392c3134302e3337352c3134302e3934382c3134322e3039342c3134322e3636362c3134332e3831322c3134332e3831322c3134342e3338352c3134352e3533312c3134362e3130342c3134372e3235302c3134382e3339363b03"
+				d_47 := "02000001925430323033303130313d352c303b303130323d313b303230313d303b303230323d303b303330313d302e3030352c302e3030322c302e3030322c302e3030342c302e3030362c302e3030332c302e3030312c302e3030322c302e3030322c302e3030342c302e3030322c302e3030302c302e3030312c302e3030342c302e3030342c302e3030332c302e3030312c302e3030322c302e3030342c302e3030352c302e3030352c302e3030322c302e3030332c302e3030352c302e3030363b303330323d3938342e3334312c3938362e3036302c3938372e3230362c3938382e3335322c3938382e3335322c3938392e3439382c3939302e3634342c3939312e3739302c3939322e3933362c3939342e3038322c3939342e3038322c3939352e3232382c3939352e3830312c3939362e3934362c3939382e3039322c3939382e3636352c3939382e3636352c3939392e3831312c313030302e3338342c313030312e3533302c313030322e3637362c313030332e3234392c313030332e3234392c313030342e3339352c313030352e3534313b03"
+				d_59 := "020000010e5430323033303130313d352c303b303130323d313b303230313d313b303230323d303b303330313d302e3030322c302e3030332c302e3030312c302e3030312c302e3030322c302e3030332c302e3030322c302e3030302c302e3030312c302e3030312c302e3030332c302e3030332c302e3030302c302e3030312c302e3030313b303330323d313234332e3839312c313234362e3138332c313234362e3735362c313234372e3930322c313234392e3034382c313234392e3034382c313235302e3139342c313235302e3736372c313235312e3931332c313235332e3035392c313235342e3230342c313235342e3230342c313235342e3737372c313235352e3932332c313235372e3036393b03"
+				r_1 := "02000000da543032303230303031303d302e3031322c302e3030302c332e3030302c313235372e3036393b30303031313d323b30303031323d35323b30313031303d302e3030302c302e3030302c302e3030303b30313031313d313b30313032303d302e3030302c302e3030302c302e3030303b30313032313d313b30313033303d302e3030302c302e3030302c302e3030303b30313033313d313b30313034303d302e3030302c302e3030302c302e3030303b30313034313d313b30313035303d302e3031322c313235372e3036392c332e3030303b30313035313d363b03"
+				m_0 := "020000010e5430323033303130313d352c303b303130323d313b303230313d313b303230323d303b303330313d302e3030322c302e3030332c302e3030312c302e3030312c302e3030322c302e3030332c302e3030322c302e3030302c302e3030312c302e3030312c302e3030332c302e3030332c302e3030302c302e3030312c302e3030313b303330323d313234332e3839312c313234362e3138332c313234362e3735362c313234372e3930322c313234392e3034382c313234392e3034382c313235302e3139342c313235302e3736372c313235312e3931332c313235332e3035392c313235342e3230342c313235342e3230342c313235342e3737372c313235352e3932332c313235372e3036393b03"
+				m_1 := "02000001725430323033303130313d352c303b303130323d313b303230313d303b303230323d303b303330313d302e3030362c302e3030322c302e3030342c302e3030312c302e3030312c302e3030312c302e3030302c302e3030302c302e3030322c302e3030322c302e3030342c302e3030302c302e3030302c302e3030302c302e3030312c302e3030302c302e3030322c302e3030342c302e3030322c302e3030322c302e3030302c302e3030322c302e3030312c302e3030312c302e3030323b303330323d32352e3231302c32362e3335362c32392e3739342c33302e3934302c33312e3531332c33312e3531332c33342e3935302c33352e3532332c33362e3636392c33372e3831352c33382e3936312c33382e3936312c33392e3533342c34302e3638302c34332e3534352c34332e3534352c34342e3639312c34352e3833372c34362e3938332c34372e3535352c34382e3730312c34382e3730312c35312e3536362c35322e3731322c35332e3835383b03"
+				m_3 := "020000017b5430323033303130313d352c303b303130323d313b303230313d303b303230323d303b303330313d302e3030322c302e3030312c302e3030322c302e3030322c302e3030352c302e3030352c302e3030362c302e3030332c302e3030332c302e3030362c302e3030322c302e3030342c302e3030322c302e3030322c302e3030312c302e3030322c302e3030352c302e3030342c302e3030362c302e3030362c302e3030352c302e3030332c302e3030342c302e3030362c302e3030363b303330323d38302e3231342c38312e3933332c38342e3739382c38352e3337312c38362e3531372c38372e3636332c38382e3830382c38382e3830382c38392e3935342c39322e3234362c39352e3131312c39362e3235372c39372e3430332c39372e3937362c39392e3132322c39392e3132322c3130302e3236382c3130332e3133322c3130332e3730352c3130342e3835312c3130352e3939372c3130362e3537302c3130362e3537302c3130372e3731362c3130382e3836323b03"
+				m_4 := "020000017b5430323033303130313d352c303b303130323d313b303230313d303b303230323d303b303330313d302e3030322c302e3030312c302e3030322c302e3030322c302e3030352c302e3030352c302e3030362c302e3030332c302e3030332c302e3030362c302e3030322c302e3030342c302e3030322c302e3030322c302e3030312c302e3030322c302e3030352c302e3030342c302e3030362c302e3030362c302e3030352c302e3030332c302e3030342c302e3030362c302e3030363b303330323d38302e3231342c38312e3933332c38342e3739382c38352e3337312c38362e3531372c38372e3636332c38382e3830382c38382e3830382c38392e3935342c39322e3234362c39352e3131312c39362e3235372c39372e3430332c39372e3937362c39392e3132322c39392e3132322c3130302e3236382c3130332e3133322c3130332e3730352c3130342e3835312c3130352e3939372c3130362e3537302c3130362e3537302c3130372e3731362c3130382e3836323b03"
+				m_5 := "02000001a15430323033303130313d352c303b303130323d313b303230313d303b303230323d303b303330313d302e3030352c302e3030312c302e3030322c302e3030342c302e3030312c302e3030332c302e3030352c302e3030362c302e3030332c302e3030332c302e3030342c302e3030352c302e3030342c302e3030342c302e3030362c302e3030372c302e3030342c302e3030332c302e3030332c302e3030332c302e3030322c302e3030322c302e3030342c302e3030342c302e3030333b303330323d3939352e3232382c3939362e3337342c3939362e3934362c313030302e3338342c313030302e3935372c313030302e3935372c313030322e3130332c313030332e3234392c313030332e3832322c313030342e3936382c313030342e3936382c313030372e3833332c313030382e3937392c313030392e3535322c313031312e3237302c313031312e3237302c313031312e3834332c313031322e3938392c313031342e3133352c313031362e3432372c313031372e3537332c313031382e3731392c313031392e3239322c313032302e3433382c313032312e3538343b03"
+				m_6 := "02000001a45430323033303130313d352c303b303130323d313b303230313d303b303230323d303b303330313d302e3030332c302e3030312c302e3030302c302e3030312c302e3030332c302e3030332c302e3030342c302e3030302c302e3030312c302e3030312c302e3030312c302e3030302c302e3030322c302e3030332c302e3030302c302e3030302c302e3030312c302e3030302c302e3030302c302e3030302c302e3030332c302e3030352c302e3030342c302e3030332c302e3030343b303330323d313032312e3538342c313032322e3733302c313032352e3539342c313032362e3734302c313032372e3331332c313032382e3435392c313032392e3630352c313032392e3630352c313033302e3137382c313033312e3332342c313033342e3736322c313033342e3736322c313033352e3930382c313033372e3035342c313033382e3139392c313033392e3334352c313033392e3931382c313033392e3931382c313034322e3738332c313034332e3335362c313034342e3530322c313034342e3530322c313034352e3037352c313034362e3232312c313034362e3739343b03"
+				m_7 := "02000000965430323033303130313d352c303b303130323d313b303230313d313b303230323d303b303330313d302e3030352c302e3030342c302e3030362c302e3030342c302e3030312c302e3030322c302e3030313b303330323d313234372e3930322c313235302e3139342c313235312e3334302c313235312e3334302c313235322e3438362c313235332e3035392c313235362e3439363b03"
+
+				sendHexString(conn, d_0)
+				time.Sleep(time.Millisecond * 200)
+				sendHexString(conn, d_1)
+				time.Sleep(time.Millisecond * 200)
+				sendHexString(conn, d_2)
+				time.Sleep(time.Millisecond * 200)
+				sendHexString(conn, d_3)
+				time.Sleep(time.Millisecond * 200)
+				sendHexString(conn, d_5)
+				time.Sleep(time.Millisecond * 200)
+				sendHexString(conn, d_6)
+				time.Sleep(time.Millisecond * 200)
+				sendHexString(conn, d_7)
+				time.Sleep(time.Millisecond * 200)
+				sendHexString(conn, d_47)
+				time.Sleep(time.Millisecond * 200)
+				sendHexString(conn, d_59)
+				time.Sleep(time.Millisecond * 200)
+				sendHexString(conn, r_1)
+
+				time.Sleep(time.Second * 5)
+				sendHexString(conn, m_0)
+				time.Sleep(time.Millisecond * 200)
+				sendHexString(conn, m_1)
+				time.Sleep(time.Millisecond * 200)
+				sendHexString(conn, m_3)
+				time.Sleep(time.Millisecond * 200)
+				sendHexString(conn, m_4)
+				time.Sleep(time.Millisecond * 200)
+				sendHexString(conn, m_5)
+				time.Sleep(time.Millisecond * 200)
+				sendHexString(conn, m_6)
+				time.Sleep(time.Millisecond * 200)
+				sendHexString(conn, m_7)
+				time.Sleep(time.Millisecond * 200)
+				sendHexString(conn, r_1)
+
+				t.Log("close")
+				return
+			default:
+				fmt.Println("server receive unknown package:", hex.EncodeToString(recData[:n]))
+			}
+		}
+	}()
+
+	// 创建一个 DanikorTCPConnection 实例
+	dc := NewDanikorTCPConnection(listener.Addr().String(), func(ansData AnsData) {
+		fmt.Println("test receiveCallBack mid:", string(ansData.MID))
+		switch ansData.MID {
+		case "0203":
+			fmt.Println("realtime torque:", ansData.Torque.Pset, ansData.Torque.IsCurveStart, ansData.Torque.IsCurveEnd)
+		case "0202":
+			fmt.Printf("Ng Reason:%s\n", ansData.TorqueResult.ShowNgCode())
+			fmt.Println("torque result:", ansData.TorqueResult.FinalAngleFinal)
+		}
+	})
+
+	cycles, cancel := dc.Cycles()
+	defer cancel()
+
+	// 测试 Dial() 方法
+	if err := dc.Dial(); err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	if _, err := dc.Establish(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := dc.SubscribeRealTimeData(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := dc.SubscribeResultData(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := dc.ForwardTurn(ctx); err != nil {
+		t.Fatal(err)
+	}
+	dc.StartReceiveData()
+
+	// d_1 starts a curve, d_59 ends it, r_1 completes the cycle. The m_*
+	// frames join a curve in the middle, so the second r_1 comes alone.
+	cycle := <-cycles
+	if cycle.Curve == nil || cycle.Result == nil {
+		t.Fatalf("first cycle incomplete: %+v", cycle)
+	}
+	if n := len(cycle.Curve.Torque); n != 166 || len(cycle.Curve.Angle) != 166 || len(cycle.Curve.Time) != 166 {
+		t.Fatalf("curve has %d torque, %d angle, %d time samples, want 166", n, len(cycle.Curve.Angle), len(cycle.Curve.Time))
+	}
+	if last := cycle.Curve.Angle[165]; last != 1257.069 {
+		t.Fatalf("last angle %v, want 1257.069", last)
+	}
+	cycle = <-cycles
+	if cycle.Curve != nil || cycle.Result == nil {
+		t.Fatalf("second cycle: %+v", cycle)
+	}
+}
+
+func TestDanikorTCPConnection_AckCorrelation(t *testing.T) {
+	client, server := net.Pipe()
+	defer server.Close()
+
+	pushes := make(chan AnsData, 4)
+	dc := NewDanikorTCPConnection("", func(ansData AnsData) { pushes <- ansData }, WithErrorCallBack(func(error) {}))
+	dc.attach(client)
+	defer dc.Close()
+
+	go func() {
+		fr := NewFrameReader(server)
+		for {
+			frame, err := fr.ReadFrame()
+			if err != nil {
+				return
+			}
+			var req Request
+			if err := req.UnmarshalBinary(frame); err != nil {
+				t.Error(err)
+				return
+			}
+			switch req.MID {
+			case "0301":
+				// a curve push sneaks in before the ack
+				sendHexString(server, "02000000395430323033303130313d352c303b303130323d313b303230313d303b303230323d313b303330313d302e3030303b303330323d302e3030303b03")
+				sendHexString(server, "0200000008413033303141434b03")
+			case "0104":
+				sendHexString(server, "02000000084130313034"+hex.EncodeToString([]byte("NAK"))+"03")
+			}
+		}
+	}()
+
+	ctx := context.Background()
+	ack, err := dc.ForwardTurn(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ack.MID != "0301" || string(ack.Data) != "ACK" {
+		t.Fatalf("unexpected ack %+v", ack)
+	}
+	if push := <-pushes; push.MID != "0203" {
+		t.Fatalf("unexpected push %+v", push)
+	}
+
+	if _, err := dc.Do(ctx, NewRequest(ModeWrite, "0104", Param{"01", "1"})); !errors.Is(err, ErrNak) {
+		t.Fatalf("got %v, want ErrNak", err)
+	}
+
+	tctx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	if _, err := dc.Do(tctx, NewRequest(ModeRead, "0999")); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("got %v, want context.DeadlineExceeded", err)
+	}
+}
+
+func TestDanikorTCPConnection_DialContext(t *testing.T) {
+	// grab a free port and close it again so nothing listens there
+	listener, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := listener.Addr().String()
+	listener.Close()
+
+	var attempts []int
+	dc := NewDanikorTCPConnection(addr, nil,
+		WithBackoff(time.Millisecond, 4*time.Millisecond),
+		WithMaxAttempts(3),
+		WithDialErrorHook(func(attempt int, err error) { attempts = append(attempts, attempt) }))
+	if err := dc.DialContext(context.Background()); err == nil {
+		t.Fatal("expected dial to fail")
+	}
+	if len(attempts) != 3 || attempts[2] != 3 {
+		t.Fatalf("got attempts %v, want [1 2 3]", attempts)
+	}
+
+	dc = NewDanikorTCPConnection(addr, nil, WithBackoff(time.Hour, time.Hour))
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := dc.DialContext(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("got %v, want context.DeadlineExceeded", err)
+	}
+}
+
+// ackServer acks every request with the request's MID and reports it on
+// requests as "<conn number> <request>". Connections for which drop returns
+// true are closed right after the ack.
+func ackServer(t *testing.T, drop func(connNum int, req *Request) bool) (addr string, requests chan string) {
+	listener, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	requests = make(chan string, 64)
+	go func() {
+		for connNum := 1; ; connNum++ {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
 			}
+			go func(connNum int, conn net.Conn) {
+				defer conn.Close()
+				serveAcks(conn, func(hexStr string) { sendHexString(conn, hexStr) }, func(req *Request) (bool, bool) {
+					requests <- fmt.Sprintf("%d %s", connNum, req)
+					return true, drop != nil && drop(connNum, req)
+				})
+			}(connNum, conn)
+		}
+	}()
+	return listener.Addr().String(), requests
+}
+
+// pipeServer is the controller end of a net.Pipe. It acks every request
+// with the request's MID, except those silent returns true for, and reports
+// it on requests.
+type pipeServer struct {
+	conn     net.Conn
+	mu       sync.Mutex // serializes the frames written to conn
+	requests chan string
+}
 
-			t.Log("close")
-			conn.Close()
+// newPipeServer returns the client end of the pipe, to be attached, and
+// the server end.
+func newPipeServer(t *testing.T, silent func(req *Request) bool) (net.Conn, *pipeServer) {
+	client, server := net.Pipe()
+	t.Cleanup(func() { server.Close() })
+	s := &pipeServer{conn: server, requests: make(chan string, 1024)}
+	go serveAcks(server, s.send, func(req *Request) (bool, bool) {
+		s.requests <- req.String()
+		return silent == nil || !silent(req), false
+	})
+	return client, s
+}
+
+// send writes the frame given in hex.
+func (s *pipeServer) send(hexStr string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sendHexString(s.conn, hexStr)
+}
+
+// serveAcks reads requests from conn until it fails. handle says whether
+// to ack a request and whether to stop after it.
+func serveAcks(conn net.Conn, send func(hexStr string), handle func(req *Request) (ack, stop bool)) {
+	fr := NewFrameReader(conn)
+	for {
+		frame, err := fr.ReadFrame()
+		if err != nil {
 			return
 		}
+		req := &Request{}
+		if err := req.UnmarshalBinary(frame); err != nil {
+			return
+		}
+		ack, stop := handle(req)
+		if ack {
+			send("020000000841" + hex.EncodeToString([]byte(req.MID)) + "41434b03")
+		}
+		if stop {
+			return
+		}
+	}
+}
+
+func TestDanikorTCPConnection_Run(t *testing.T) {
+	addr, requests := ackServer(t, func(connNum int, req *Request) bool {
+		return connNum == 1 && req.MID == "0202"
+	})
+
+	states := make(chan ConnState, 16)
+	dc := NewDanikorTCPConnection(addr, nil,
+		WithBackoff(time.Millisecond, time.Millisecond),
+		WithErrorCallBack(func(error) {}),
+		WithStateCallBack(func(s ConnState) { states <- s }))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	runErr := make(chan error, 1)
+	go func() { runErr <- dc.Run(ctx) }()
+
+	wantState := func(want ConnState) {
+		t.Helper()
+		select {
+		case s := <-states:
+			if s != want {
+				t.Fatalf("got state %v, want %v", s, want)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timeout waiting for state %v", want)
+		}
+	}
+	wantState(StateConnecting)
+	wantState(StateConnected)
+
+	// the first session: pset 3, curves, then results, which drops the link
+	if _, err := dc.ChosePset(ctx, 3); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := dc.SubscribeRealTimeData(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := dc.SubscribeResultData(ctx); err != nil {
+		t.Fatal(err)
+	}
+	wantState(StateLost)
+	wantState(StateConnecting)
+	wantState(StateRestored)
+
+	var got []string
+	for len(got) < 8 {
+		got = append(got, <-requests)
+	}
+	want := []string{
+		"1 R0001", "1 W010301=3;", "1 R0203", "1 R0202",
+		"2 R0001", "2 W010301=3;", "2 R0203", "2 R0202",
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("got requests %q, want %q", got, want)
+		}
+	}
+
+	cancel()
+	if err := <-runErr; !errors.Is(err, context.Canceled) {
+		t.Fatalf("Run returned %v", err)
+	}
+	wantState(StateDisconnected)
+}
+
+func TestDanikorTCPConnection_Heartbeat(t *testing.T) {
+	client, server := net.Pipe()
+	defer server.Close()
+
+	// the server acks the first two heartbeats, then goes silent like a
+	// pulled cable: it keeps reading but never answers
+	go func() {
+		fr := NewFrameReader(server)
+		for n := 0; ; n++ {
+			if _, err := fr.ReadFrame(); err != nil {
+				return
+			}
+			if n < 2 {
+				sendHexString(server, "0200000008413030303141434b03")
+			}
+		}
 	}()
 
-	// 创建一个 DanikorTCPConnection 实例
-	dc := &DanikorTCPConnection{
-		address: listener.Addr().String(),
-		receiveCallBack: func(ansData AnsData) {
-			fmt.Println("test receiveCallBack mid:", string(ansData.MID))
-			switch ansData.MID {
-			case "0203":
-				fmt.Println("realtime torque:", ansData.Torque.Pset, ansData.Torque.IsCurveStart, ansData.Torque.IsCurveEnd)
-			case "0202":
-				fmt.Printf("Ng Reason:%s\n", ansData.TorqueResult.ShowNgCode())
-				fmt.Println("torque result:", ansData.TorqueResult.FinalAngleFinal)
+	errs := make(chan error, 8)
+	dc := NewDanikorTCPConnection("", nil,
+		WithHeartbeat(20*time.Millisecond, 3),
+		WithErrorCallBack(func(err error) { errs <- err }))
+	dc.attach(client)
+
+	finished := make(chan struct{})
+	go func() {
+		dc.StartReceiveData()
+		close(finished)
+	}()
+	select {
+	case <-finished:
+	case <-time.After(5 * time.Second):
+		t.Fatal("dead link not detected")
+	}
+
+	for {
+		select {
+		case err := <-errs:
+			if errors.Is(err, ErrLinkDead) {
+				return
 			}
-		},
+		default:
+			t.Fatal("ErrLinkDead not reported")
+		}
 	}
+}
 
-	// 测试 Dial() 方法
-	dc.Dial()
-	dc.Establish()
-	dc.SubscribeRealTimeData()
-	dc.SubscribeResultData()
-	dc.ForwardTurn()
+func TestDanikorTCPConnection_ConcurrentCommands(t *testing.T) {
+	client, server := newPipeServer(t, nil)
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		// a busy tool streaming curve fragments the whole time
+		for {
+			select {
+			case <-stop:
+				return
+			case <-time.After(200 * time.Microsecond):
+				server.send("02000000395430323033303130313d352c303b303130323d313b303230313d303b303230323d313b303330313d302e3030303b303330323d302e3030303b03")
+			}
+		}
+	}()
+
+	var pushes int64
+	var pushMu sync.Mutex
+	dc := NewDanikorTCPConnection("", func(ansData AnsData) {
+		pushMu.Lock()
+		pushes++
+		pushMu.Unlock()
+	}, WithErrorCallBack(func(error) {}))
+	dc.attach(client)
+	go dc.StartReceiveData()
+
+	ctx := context.Background()
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 20; i++ {
+				ack, err := dc.ChosePset(ctx, (g+i)%8+1)
+				if err != nil || ack.MID != "0103" {
+					t.Errorf("ChosePset: %v %+v", err, ack)
+					return
+				}
+				ack, err = dc.Establish(ctx)
+				if err != nil || ack.MID != "0001" {
+					t.Errorf("Establish: %v %+v", err, ack)
+					return
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+	dc.Close()
+
+	pushMu.Lock()
+	defer pushMu.Unlock()
+	if pushes == 0 {
+		t.Error("no pushes delivered while commands were running")
+	}
+}
+
+func TestDanikorTCPConnection_CommandFromCallback(t *testing.T) {
+	client, server := newPipeServer(t, nil)
+	go server.send(testResultFrame) // the callback runs on this push
+
+	errs := make(chan error, 1)
+	var dc *DanikorTCPConnection
+	dc = NewDanikorTCPConnection("", func(ansData AnsData) {
+		// a command issued from the callback gets its ack
+		_, err := dc.ChosePset(context.Background(), 2)
+		errs <- err
+	}, WithTimeout(time.Second), WithErrorCallBack(func(error) {}))
+	dc.attach(client)
+	defer dc.Close()
+
+	select {
+	case err := <-errs:
+		if err != nil {
+			t.Fatalf("ChosePset from the callback: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("callback did not run")
+	}
+}
+
+type recordLogger struct {
+	mu    sync.Mutex
+	lines []string
+}
+
+func (l *recordLogger) log(level, msg string, args ...any) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.lines = append(l.lines, strings.TrimSuffix(fmt.Sprintln(append([]any{level, msg}, args...)...), "\n"))
+}
+
+func (l *recordLogger) Debug(msg string, args ...any) { l.log("DEBUG", msg, args...) }
+func (l *recordLogger) Info(msg string, args ...any)  { l.log("INFO", msg, args...) }
+func (l *recordLogger) Warn(msg string, args ...any)  { l.log("WARN", msg, args...) }
+func (l *recordLogger) Error(msg string, args ...any) { l.log("ERROR", msg, args...) }
+
+func TestDanikorTCPConnection_Logger(t *testing.T) {
+	client, server := net.Pipe()
+	defer server.Close()
+	go func() {
+		fr := NewFrameReader(server)
+		if _, err := fr.ReadFrame(); err == nil {
+			sendHexString(server, "0200000008413030303141434b03")
+		}
+	}()
+
+	logger := &recordLogger{}
+	dc := NewDanikorTCPConnection("tool-1", nil, WithLogger(logger))
+	dc.attach(client)
+	if _, err := dc.Establish(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	dc.Close()
 	dc.StartReceiveData()
+
+	logger.mu.Lock()
+	defer logger.mu.Unlock()
+	want := []string{
+		"DEBUG danikor: frame sent addr tool-1 frame 0200000005523030303103",
+		"DEBUG danikor: frame received addr tool-1 frame 0200000008413030303141434b03",
+	}
+	for i, w := range want {
+		if i >= len(logger.lines) || logger.lines[i] != w {
+			t.Fatalf("got log %q, want %q first", logger.lines, want)
+		}
+	}
+	if last := logger.lines[len(logger.lines)-1]; !strings.HasPrefix(last, "ERROR") {
+		t.Fatalf("closing the connection was not logged as an error: %q", last)
+	}
+}
+
+// paramServer is a controller with a parameter store behind net.Pipe. 'R'
+// answers with the requested keys (all of the MID when none are given), 'W'
+// stores the values. Keys listed in readOnly are rejected with NAK.
+func paramServer(t *testing.T, store map[string]map[string]string, readOnly ...string) *DanikorTCPConnection {
+	client, server := net.Pipe()
+	t.Cleanup(func() { server.Close() })
+
+	var mu sync.Mutex
+	go func() {
+		fr := NewFrameReader(server)
+		for {
+			frame, err := fr.ReadFrame()
+			if err != nil {
+				return
+			}
+			var req Request
+			if err := req.UnmarshalBinary(frame); err != nil {
+				t.Error(err)
+				return
+			}
+
+			mu.Lock()
+			values := store[req.MID]
+			if values == nil {
+				values = make(map[string]string)
+				store[req.MID] = values
+			}
+			answer := &Request{Mode: ModeAck, MID: req.MID}
+			switch req.Mode {
+			case ModeRead:
+				if len(req.Params) == 0 {
+					keys := make([]string, 0, len(values))
+					for key := range values {
+						keys = append(keys, key)
+					}
+					sort.Strings(keys)
+					for _, key := range keys {
+						answer.Params = append(answer.Params, Param{key, values[key]})
+					}
+				}
+				for _, p := range req.Params {
+					if v, ok := values[p.Key]; ok {
+						answer.Params = append(answer.Params, Param{p.Key, v})
+					}
+				}
+			case ModeWrite:
+				answer.Params = Params{{"ACK", ""}}
+				for _, p := range req.Params {
+					for _, ro := range readOnly {
+						if req.MID+p.Key == ro {
+							answer.Params = Params{{"NAK", ""}}
+						}
+					}
+				}
+				if answer.Params[0].Key == "ACK" {
+					for _, p := range req.Params {
+						values[p.Key] = p.Value
+					}
+				}
+			}
+			mu.Unlock()
+
+			data, err := answer.MarshalBinary()
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			server.Write(data)
+		}
+	}()
+
+	dc := NewDanikorTCPConnection("", nil)
+	dc.attach(client)
+	t.Cleanup(func() { dc.Close() })
+	return dc
+}
+
+func TestDanikorTCPConnection_ReadWriteParams(t *testing.T) {
+	store := map[string]map[string]string{
+		"0103": {"01": "1"},
+		"0501": {"01": "12.500", "02": "0"},
+	}
+	dc := paramServer(t, store, "050199")
+	ctx := context.Background()
+
+	params, err := dc.ReadParams(ctx, "0501", "01", "02")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f, _ := params.Float("01"); f != 12.5 {
+		t.Errorf("got %v, want 12.5", params)
+	}
+
+	if err := dc.WriteParams(ctx, "0501", map[string]string{"02": "1", "01": "15.000"}); err != nil {
+		t.Fatal(err)
+	}
+	if store["0501"]["01"] != "15.000" || store["0501"]["02"] != "1" {
+		t.Errorf("write not applied: %v", store["0501"])
+	}
+	params, err = dc.ReadParams(ctx, "0501")
+	if err != nil || !reflect.DeepEqual(params, Params{{"01", "15.000"}, {"02", "1"}}) {
+		t.Errorf("read all: %v %v", params, err)
+	}
+
+	if err := dc.WriteParams(ctx, "0501", map[string]string{"99": "1"}); !errors.Is(err, ErrNak) {
+		t.Errorf("read only key: got %v, want ErrNak", err)
+	}
+	if _, err := dc.ReadParams(ctx, "0501", "77"); !errors.Is(err, ErrMissingParam) {
+		t.Errorf("unknown key: got %v, want ErrMissingParam", err)
+	}
 }
@@ -0,0 +1,141 @@
+package danikortest
+
+import (
+	"encoding/binary"
+	"time"
+)
+
+// FaultKind is a way of breaking the frames a Server sends.
+type FaultKind int
+
+const (
+	FaultFragment      FaultKind = iota // write the frame in pieces cut at Offsets
+	FaultCoalesce                       // hold the frame back and send it in one write with the next one
+	FaultDuplicate                      // send the frame twice
+	FaultCorruptHeader                  // replace the 0x02 header byte
+	FaultCorruptLength                  // add one to the DataLen field
+	FaultCorruptTailer                  // replace the 0x03 tailer byte
+	FaultDelay                          // stall Delay before sending, e.g. to push an ack past the client timeout
+	FaultDisconnect                     // close the connection instead of sending
+)
+
+// fragmentGap separates the pieces of a fragmented frame so they arrive in
+// separate reads.
+const fragmentGap = 2 * time.Millisecond
+
+// Fault breaks one frame sent by the server: the first frame matching Mode
+// and MID after Skip matching frames went out unharmed.
+type Fault struct {
+	Kind    FaultKind
+	Mode    byte   // danikor.ModeAck or ModeTransmit, 0 for any
+	MID     string // "" for any
+	Skip    int
+	Offsets []int         // FaultFragment: byte offsets to cut at
+	Delay   time.Duration // FaultDelay
+}
+
+func (f *Fault) match(frame []byte) bool {
+	if len(frame) < 10 {
+		return false
+	}
+	if f.Mode != 0 && frame[5] != f.Mode {
+		return false
+	}
+	return f.MID == "" || string(frame[6:10]) == f.MID
+}
+
+// Inject queues faults. Each one fires once, on the first frame it matches;
+// when several match a frame, the one injected first fires.
+func (s *Server) Inject(faults ...Fault) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.faults = append(s.faults, faults...)
+}
+
+// PendingFaults is the number of injected faults that have not fired yet.
+func (s *Server) PendingFaults() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.faults)
+}
+
+// takeFault removes and returns the fault that fires on frame, if any.
+func (s *Server) takeFault(frame []byte) (Fault, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := range s.faults {
+		f := &s.faults[i]
+		if !f.match(frame) {
+			continue
+		}
+		if f.Skip > 0 {
+			f.Skip--
+			continue
+		}
+		fault := *f
+		s.faults = append(s.faults[:i], s.faults[i+1:]...)
+		return fault, true
+	}
+	return Fault{}, false
+}
+
+// send writes one frame, applying the fault it triggers. c.mu is held.
+func (c *serverConn) send(frame []byte) error {
+	f, ok := c.server.takeFault(frame)
+	if !ok {
+		return c.write(frame)
+	}
+
+	switch f.Kind {
+	case FaultFragment:
+		last := 0
+		for _, off := range f.Offsets {
+			if off <= last || off >= len(frame) {
+				continue
+			}
+			if err := c.write(frame[last:off]); err != nil {
+				return err
+			}
+			time.Sleep(fragmentGap)
+			last = off
+		}
+		return c.write(frame[last:])
+	case FaultCoalesce:
+		c.held = append(c.held, frame...)
+		return nil
+	case FaultDuplicate:
+		if err := c.write(frame); err != nil {
+			return err
+		}
+		return c.write(frame)
+	case FaultCorruptHeader:
+		bad := append([]byte(nil), frame...)
+		bad[0] = 0xFF
+		return c.write(bad)
+	case FaultCorruptLength:
+		bad := append([]byte(nil), frame...)
+		binary.BigEndian.PutUint32(bad[1:5], binary.BigEndian.Uint32(bad[1:5])+1)
+		return c.write(bad)
+	case FaultCorruptTailer:
+		bad := append([]byte(nil), frame...)
+		bad[len(bad)-1] = 0xFF
+		return c.write(bad)
+	case FaultDelay:
+		time.Sleep(f.Delay)
+		return c.write(frame)
+	case FaultDisconnect:
+		c.conn.Close()
+		return errDisconnected
+	}
+	return c.write(frame)
+}
+
+// write sends data together with frames held back by FaultCoalesce.
+func (c *serverConn) write(data []byte) error {
+	if len(c.held) > 0 {
+		data = append(c.held, data...)
+		c.held = nil
+	}
+	_, err := c.conn.Write(data)
+	return err
+}
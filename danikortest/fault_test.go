@@ -0,0 +1,114 @@
+package danikortest
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/linexjlin/danikor"
+)
+
+func TestFaultFraming(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+	dc := danikor.NewDanikorTCPConnection(s.Addr(), nil,
+		danikor.WithTimeout(200*time.Millisecond),
+		danikor.WithErrorCallBack(func(error) {}))
+	if err := dc.DialContext(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	defer dc.Close()
+	ctx := context.Background()
+
+	// frames that arrive whole in the end are all answered
+	s.Inject(
+		Fault{Kind: FaultFragment, Offsets: []int{1, 3, 7, 9}},
+		Fault{Kind: FaultDuplicate},
+		Fault{Kind: FaultCoalesce, MID: "0203"},
+	)
+	for i := 0; i < 2; i++ {
+		if _, err := dc.Establish(ctx); err != nil {
+			t.Fatalf("establish %d: %v", i, err)
+		}
+	}
+	// the 0203 ack is held back until the 0202 ack goes out with it
+	if _, err := dc.SubscribeRealTimeData(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("coalesced ack arrived alone: %v", err)
+	}
+	if _, err := dc.SubscribeResultData(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// a broken frame loses its ack, the client resyncs on the next one
+	for _, kind := range []FaultKind{FaultCorruptHeader, FaultCorruptLength, FaultCorruptTailer} {
+		s.Inject(Fault{Kind: kind, MID: "0001"})
+		if _, err := dc.Establish(ctx); !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("fault %d: got %v, want a timeout", kind, err)
+		}
+		if _, err := dc.ChosePset(ctx, 2); err != nil {
+			t.Fatalf("fault %d: no resync: %v", kind, err)
+		}
+	}
+
+	s.Inject(Fault{Kind: FaultDelay, Mode: danikor.ModeAck, Delay: 300 * time.Millisecond})
+	if _, err := dc.Establish(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("delayed ack: got %v, want a timeout", err)
+	}
+	if n := s.PendingFaults(); n != 0 {
+		t.Fatalf("%d faults did not fire", n)
+	}
+}
+
+func TestFaultDisconnectMidCurve(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+	states := make(chan danikor.ConnState, 16)
+	dc := danikor.NewDanikorTCPConnection(s.Addr(), nil,
+		danikor.WithBackoff(time.Millisecond, time.Millisecond),
+		danikor.WithErrorCallBack(func(error) {}),
+		danikor.WithStateCallBack(func(st danikor.ConnState) { states <- st }))
+	cycles, cancel := dc.Cycles()
+	defer cancel()
+
+	ctx, stop := context.WithCancel(context.Background())
+	defer stop()
+	go dc.Run(ctx)
+	waitState := func(want danikor.ConnState) {
+		t.Helper()
+		for {
+			select {
+			case st := <-states:
+				if st == want {
+					return
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatalf("timeout waiting for state %v", want)
+			}
+		}
+	}
+	waitState(danikor.StateConnected)
+	if _, err := dc.SubscribeRealTimeData(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := dc.SubscribeResultData(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	s.Inject(Fault{Kind: FaultDisconnect, MID: "0203", Skip: 1})
+	if _, err := dc.ForwardTurn(ctx); err != nil {
+		t.Fatal(err)
+	}
+	waitState(danikor.StateRestored)
+	if dc.CycleInProgress() {
+		t.Fatal("half a curve survived the reconnect")
+	}
+
+	if _, err := dc.ForwardTurn(ctx); err != nil {
+		t.Fatal(err)
+	}
+	c := nextCycle(t, cycles)
+	if c.Curve == nil || len(c.Curve.Torque) != 100 || c.Result == nil {
+		t.Fatalf("got cycle %+v after reconnect", c)
+	}
+}
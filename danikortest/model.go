@@ -0,0 +1,165 @@
+package danikortest
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/linexjlin/danikor"
+)
+
+// DefaultPset is the program of every pset of a new Server: 5 N·m in a
+// rundown and a final stage.
+var DefaultPset = danikor.Pset{
+	TargetTorque: 5, TorqueMin: 4.5, TorqueMax: 5.5, AngleMin: 360, AngleMax: 1440, Speed: 300, TimeLimit: 5,
+	Stages: []danikor.StageSetting{
+		{Index: 1, TargetTorque: 1, Speed: 600, AngleMax: 1080},
+		{Index: 2, TargetTorque: 5, Speed: 100, AngleMax: 360},
+	},
+}
+
+// SampleInterval is the sampling period of the curves a Server sends. The
+// 0101 field carries it as a rate in units of 100 Hz, "5" for 500 Hz.
+const SampleInterval = 2 * time.Millisecond
+
+// Tightening is where a simulated cycle ends. The result is OK when both
+// values are inside the windows of the pset.
+type Tightening struct {
+	FinalTorque float64
+	FinalAngle  float64
+}
+
+func defaultTightening(pset int, p danikor.Pset) Tightening {
+	return Tightening{FinalTorque: p.TargetTorque, FinalAngle: (p.AngleMin + p.AngleMax) / 2}
+}
+
+// storePset writes p to the parameter table with danikor.DefaultPsetLayout,
+// where GetPset and SetPset of a client find it.
+func (s *Server) storePset(n int, p danikor.Pset) {
+	l := danikor.DefaultPsetLayout
+	s.params[l.MID(n)] = map[string]string{
+		l.TargetTorque: format(p.TargetTorque),
+		l.TorqueMin:    format(p.TorqueMin),
+		l.TorqueMax:    format(p.TorqueMax),
+		l.AngleMin:     format(p.AngleMin),
+		l.AngleMax:     format(p.AngleMax),
+		l.Speed:        format(p.Speed),
+		l.TimeLimit:    format(p.TimeLimit),
+		l.StageCount:   strconv.Itoa(len(p.Stages)),
+	}
+	for _, st := range p.Stages {
+		s.params[l.StageMID(n, st.Index)] = map[string]string{
+			l.StageTargetTorque: format(st.TargetTorque),
+			l.StageSpeed:        format(st.Speed),
+			l.StageAngleMin:     format(st.AngleMin),
+			l.StageAngleMax:     format(st.AngleMax),
+		}
+	}
+}
+
+// loadPset reads pset n back from the parameter table, including what a
+// client changed with SetPset. Values that do not parse read as zero.
+func (s *Server) loadPset(n int) danikor.Pset {
+	l := danikor.DefaultPsetLayout
+	values := s.params[l.MID(n)]
+	get := func(values map[string]string, key string) float64 {
+		v, _ := strconv.ParseFloat(values[key], 64)
+		return v
+	}
+	p := danikor.Pset{
+		TargetTorque: get(values, l.TargetTorque),
+		TorqueMin:    get(values, l.TorqueMin),
+		TorqueMax:    get(values, l.TorqueMax),
+		AngleMin:     get(values, l.AngleMin),
+		AngleMax:     get(values, l.AngleMax),
+		Speed:        get(values, l.Speed),
+		TimeLimit:    get(values, l.TimeLimit),
+	}
+	stages, _ := strconv.Atoi(values[l.StageCount])
+	for i := 1; i <= stages; i++ {
+		sv := s.params[l.StageMID(n, i)]
+		p.Stages = append(p.Stages, danikor.StageSetting{
+			Index:        i,
+			TargetTorque: get(sv, l.StageTargetTorque),
+			Speed:        get(sv, l.StageSpeed),
+			AngleMin:     get(sv, l.StageAngleMin),
+			AngleMax:     get(sv, l.StageAngleMax),
+		})
+	}
+	return p
+}
+
+// cycle simulates a tightening with the selected pset. It returns the 0203
+// frames of the curve and the 0202 frame of the result.
+func (s *Server) cycle() (curve [][]byte, result []byte) {
+	s.mu.Lock()
+	n := s.pset
+	p := s.loadPset(n)
+	s.mu.Unlock()
+	t := s.cfg.tighten(n, p)
+
+	// torque rises with the square of the angle, the angle linearly
+	samples := s.cfg.samples
+	torque := make([]string, samples)
+	angle := make([]string, samples)
+	for i := range torque {
+		x := float64(i+1) / float64(samples)
+		torque[i] = format(t.FinalTorque * x * x)
+		angle[i] = format(t.FinalAngle * x)
+	}
+	for start := 0; start < samples; start += s.cfg.fragmentSize {
+		end := start + s.cfg.fragmentSize
+		if end > samples {
+			end = samples
+		}
+		data := fmt.Sprintf("0101=%d,0;0102=%d;0201=%s;0202=%s;0301=%s;0302=%s;",
+			int(time.Second/SampleInterval/100), n, flag(end == samples), flag(start == 0),
+			strings.Join(torque[start:end], ","), strings.Join(angle[start:end], ","))
+		curve = append(curve, Frame(danikor.ModeTransmit, "0203", data))
+	}
+
+	status, code, last := resultOf(p, t)
+	total := float64(samples) * SampleInterval.Seconds()
+	var b strings.Builder
+	fmt.Fprintf(&b, "00010=%s,%s,%s,%s;", format(t.FinalTorque), format(t.FinalAngle), format(total), format(t.FinalAngle))
+	fmt.Fprintf(&b, "00011=%d;00012=%02X;", status, uint8(code))
+	for k := 1; k <= len(p.Stages); k++ {
+		// stage k ends after its share of the samples
+		x := float64(k) / float64(len(p.Stages))
+		stageStatus := danikor.StageOK
+		if k == len(p.Stages) {
+			stageStatus = last
+		}
+		fmt.Fprintf(&b, "01%02d0=%s,%s,%s;01%02d1=%d;", k,
+			format(t.FinalTorque*x*x), format(t.FinalAngle*x), format(total*x), k, stageStatus)
+	}
+	return curve, Frame(danikor.ModeTransmit, "0202", b.String())
+}
+
+// resultOf judges t against the windows of p. It returns the final status,
+// the NG code and the status of the last stage.
+func resultOf(p danikor.Pset, t Tightening) (danikor.FinalStatus, danikor.NgCode, danikor.StageStatus) {
+	switch {
+	case t.FinalTorque > p.TorqueMax:
+		return danikor.FinalStatusNG, 0x01, danikor.StageTorqueHigh
+	case t.FinalTorque < p.TorqueMin:
+		return danikor.FinalStatusNG, 0x02, danikor.StageTorqueLow
+	case t.FinalAngle > p.AngleMax:
+		return danikor.FinalStatusNG, 0x03, danikor.StageAngleHigh
+	case t.FinalAngle < p.AngleMin:
+		return danikor.FinalStatusNG, 0x04, danikor.StageAngleLow
+	}
+	return danikor.FinalStatusOK, 0x00, danikor.StageOK
+}
+
+func format(v float64) string {
+	return strconv.FormatFloat(v, 'f', 3, 64)
+}
+
+func flag(b bool) string {
+	if b {
+		return "1"
+	}
+	return "0"
+}
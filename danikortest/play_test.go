@@ -0,0 +1,51 @@
+package danikortest
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/linexjlin/danikor"
+)
+
+func TestServerPlay(t *testing.T) {
+	// record a cycle from one simulator
+	recorded := NewServer(WithSamples(30, 10))
+	defer recorded.Close()
+	var capture bytes.Buffer
+	dc := danikor.NewDanikorTCPConnection(recorded.Addr(), nil, danikor.WithRecorder(&capture))
+	if err := dc.DialContext(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	cycles, cancel := dc.Cycles()
+	if _, err := dc.SubscribeRealTimeData(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := dc.SubscribeResultData(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := dc.ForwardTurn(ctx); err != nil {
+		t.Fatal(err)
+	}
+	want := nextCycle(t, cycles)
+	cancel()
+	dc.Close()
+
+	// and serve it to a client of another one
+	s := NewServer()
+	defer s.Close()
+	client := dial(t, s)
+	if _, err := client.Establish(ctx); err != nil {
+		t.Fatal(err)
+	}
+	got, cancel := client.Cycles()
+	defer cancel()
+	if err := s.Play(ctx, &capture, 0); err != nil {
+		t.Fatal(err)
+	}
+	c := nextCycle(t, got)
+	if len(c.Curve.Torque) != 30 || c.Result.FinalTorqueValue != want.Result.FinalTorqueValue {
+		t.Fatalf("played %+v %+v, recorded %+v %+v", c.Curve, c.Result, want.Curve, want.Result)
+	}
+}
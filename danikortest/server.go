@@ -0,0 +1,380 @@
+// Package danikortest provides a simulated Danikor controller for tests,
+// in the manner of net/http/httptest.
+//
+// A Server acks the establish, subscriptions, pset selection, motion and
+// tool commands, keeps a parameter table the client can read and write, and
+// answers a forward turn with a synthetic tightening curve and result
+// computed from the selected pset. Faults injected with Inject break the
+// frames it sends the way a bad link does.
+package danikortest
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"sort"
+	"sync"
+
+	"github.com/linexjlin/danikor"
+)
+
+// Server is a simulated controller listening on a loopback address.
+type Server struct {
+	listener net.Listener
+	cfg      config
+
+	mu       sync.Mutex
+	params   map[string]map[string]string // the controller's parameter table
+	pset     int                          // selected pset
+	requests []danikor.Request
+	faults   []Fault
+	conns    map[*serverConn]bool
+	wg       sync.WaitGroup
+}
+
+type config struct {
+	samples      int
+	fragmentSize int
+	tighten      func(pset int, p danikor.Pset) Tightening
+	onRequest    func(danikor.Request)
+	establish    bool
+}
+
+// Option configures a Server.
+type Option func(*Server)
+
+// WithPset puts program p at pset number n; by default every pset holds
+// DefaultPset.
+func WithPset(n int, p danikor.Pset) Option {
+	return func(s *Server) {
+		s.storePset(n, p)
+	}
+}
+
+// WithSamples sets the number of samples of a curve and how many of them go
+// into one 0203 frame; 100 in fragments of 40 by default.
+func WithSamples(samples, fragmentSize int) Option {
+	return func(s *Server) {
+		s.cfg.samples = samples
+		s.cfg.fragmentSize = fragmentSize
+	}
+}
+
+// WithTightening decides the outcome of every cycle, e.g. to produce NG
+// results. By default a cycle ends on the target torque in the middle of
+// the angle window.
+func WithTightening(f func(pset int, p danikor.Pset) Tightening) Option {
+	return func(s *Server) {
+		s.cfg.tighten = f
+	}
+}
+
+// WithRequestHook calls f with every request a client sends, before it is
+// answered.
+func WithRequestHook(f func(danikor.Request)) Option {
+	return func(s *Server) {
+		s.cfg.onRequest = f
+	}
+}
+
+// WithEstablishRequired makes the server NAK every request a client sends
+// before the MID 0001 establish, to catch clients that skip it.
+func WithEstablishRequired() Option {
+	return func(s *Server) {
+		s.cfg.establish = true
+	}
+}
+
+// NewServer starts a simulated controller. Close it when done.
+func NewServer(opts ...Option) *Server {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		panic("danikortest: failed to listen: " + err.Error())
+	}
+	s := &Server{
+		listener: listener,
+		cfg:      config{samples: 100, fragmentSize: 40, tighten: defaultTightening},
+		params:   make(map[string]map[string]string),
+		pset:     1,
+		conns:    make(map[*serverConn]bool),
+	}
+	for n := 1; n <= danikor.MaxPset; n++ {
+		s.storePset(n, DefaultPset)
+	}
+	s.params[danikor.DefaultToolMID] = map[string]string{"01": "1"}
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	s.wg.Add(1)
+	go s.serve()
+	return s
+}
+
+// Addr is the address to dial, e.g. "127.0.0.1:41234".
+func (s *Server) Addr() string {
+	return s.listener.Addr().String()
+}
+
+// Close stops listening, drops every client and waits for their handlers.
+func (s *Server) Close() {
+	s.listener.Close()
+	s.mu.Lock()
+	for c := range s.conns {
+		c.conn.Close()
+	}
+	s.mu.Unlock()
+	s.wg.Wait()
+}
+
+// Requests returns every request received so far, in order.
+func (s *Server) Requests() []danikor.Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]danikor.Request(nil), s.requests...)
+}
+
+// Param returns a value of the parameter table.
+func (s *Server) Param(mid, key string) (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	v, ok := s.params[mid][key]
+	return v, ok
+}
+
+// SetParam sets a value of the parameter table.
+func (s *Server) SetParam(mid, key, value string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.setParam(mid, key, value)
+}
+
+func (s *Server) setParam(mid, key, value string) {
+	if s.params[mid] == nil {
+		s.params[mid] = make(map[string]string)
+	}
+	s.params[mid][key] = value
+}
+
+// SelectedPset is the pset chosen by the last W0103.
+func (s *Server) SelectedPset() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.pset
+}
+
+// Tighten runs a cycle with the selected pset as if the operator pulled
+// the trigger, pushing its curve and result to every subscribed client.
+func (s *Server) Tighten() {
+	curve, result := s.cycle()
+	for _, c := range s.clients() {
+		c.push(curve, result)
+	}
+}
+
+// Play pushes the frames a controller sent in a capture to every client,
+// at the pace set by speed as in danikor.PlayCapture. Acks in the capture
+// are skipped; the server answers requests itself.
+func (s *Server) Play(ctx context.Context, r io.Reader, speed float64) error {
+	return danikor.PlayCapture(ctx, r, speed, func(f danikor.CapturedFrame) error {
+		if f.Direction != danikor.Received || len(f.Frame) > 5 && f.Frame[5] == danikor.ModeAck {
+			return nil
+		}
+		for _, c := range s.clients() {
+			c.mu.Lock()
+			c.send(f.Frame)
+			c.mu.Unlock()
+		}
+		return nil
+	})
+}
+
+func (s *Server) clients() []*serverConn {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	conns := make([]*serverConn, 0, len(s.conns))
+	for c := range s.conns {
+		conns = append(conns, c)
+	}
+	return conns
+}
+
+func (s *Server) serve() {
+	defer s.wg.Done()
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		c := &serverConn{server: s, conn: conn, subscribed: make(map[string]bool)}
+		s.mu.Lock()
+		s.conns[c] = true
+		s.mu.Unlock()
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			c.serve()
+			s.mu.Lock()
+			delete(s.conns, c)
+			s.mu.Unlock()
+		}()
+	}
+}
+
+// serverConn is one client of the server.
+type serverConn struct {
+	server *Server
+	conn   net.Conn
+
+	established bool // seen the MID 0001 establish, used by serve only
+
+	mu         sync.Mutex // guards the fields below and writes to conn
+	subscribed map[string]bool
+	held       []byte // frames held back by FaultCoalesce
+}
+
+func (c *serverConn) serve() {
+	defer c.conn.Close()
+	fr := danikor.NewFrameReader(c.conn)
+	for {
+		frame, err := fr.ReadFrame()
+		if err != nil {
+			return
+		}
+		var req danikor.Request
+		if err := req.UnmarshalBinary(frame); err != nil {
+			continue
+		}
+		if c.handle(req) != nil {
+			return
+		}
+	}
+}
+
+// handle answers req. A forward turn is followed by its cycle.
+func (c *serverConn) handle(req danikor.Request) error {
+	s := c.server
+	s.mu.Lock()
+	s.requests = append(s.requests, req)
+	s.mu.Unlock()
+	if s.cfg.onRequest != nil {
+		s.cfg.onRequest(req)
+	}
+
+	// the simulator speaks the default layouts of danikor
+	motion := danikor.DefaultMotionLayout
+	switch {
+	case req.MID == "0001":
+		c.established = true
+		return c.ack(req.MID, "ACK")
+
+	case s.cfg.establish && !c.established:
+		return c.ack(req.MID, "NAK")
+
+	case req.MID == "0202" || req.MID == "0203":
+		c.mu.Lock()
+		c.subscribed[req.MID] = true
+		c.mu.Unlock()
+		return c.ack(req.MID, "ACK")
+
+	case req.Mode == danikor.ModeWrite && req.MID == "0103":
+		n, err := req.Params.Int("01")
+		if err != nil || n < 1 || n > danikor.MaxPset {
+			return c.ack(req.MID, "NAK")
+		}
+		s.mu.Lock()
+		s.pset = n
+		s.mu.Unlock()
+		return c.ack(req.MID, "ACK")
+
+	case req.Mode == danikor.ModeWrite && req.MID == motion.MID:
+		v, _ := req.Params.Get("01")
+		if v == motion.Forward {
+			if enabled, _ := s.Param(danikor.DefaultToolMID, "01"); enabled == "0" {
+				return c.ack(req.MID, "NAK")
+			}
+		}
+		if err := c.ack(req.MID, "ACK"); err != nil {
+			return err
+		}
+		if v == motion.Forward {
+			curve, result := s.cycle()
+			return c.push(curve, result)
+		}
+		return nil
+
+	case req.Mode == danikor.ModeWrite:
+		s.mu.Lock()
+		for _, p := range req.Params {
+			s.setParam(req.MID, p.Key, p.Value)
+		}
+		s.mu.Unlock()
+		return c.ack(req.MID, "ACK")
+
+	case req.Mode == danikor.ModeRead:
+		s.mu.Lock()
+		values, ok := s.params[req.MID]
+		var answer danikor.Params
+		if len(req.Params) == 0 {
+			keys := make([]string, 0, len(values))
+			for key := range values {
+				keys = append(keys, key)
+			}
+			sort.Strings(keys)
+			for _, key := range keys {
+				answer = append(answer, danikor.Param{Key: key, Value: values[key]})
+			}
+		}
+		for _, p := range req.Params {
+			if v, found := values[p.Key]; found {
+				answer = append(answer, danikor.Param{Key: p.Key, Value: v})
+			}
+		}
+		s.mu.Unlock()
+		if !ok {
+			return c.ack(req.MID, "NAK")
+		}
+		return c.ack(req.MID, answer.String())
+	}
+	return c.ack(req.MID, "NAK")
+}
+
+func (c *serverConn) ack(mid, data string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.send(Frame(danikor.ModeAck, mid, data))
+}
+
+// push sends the frames of a cycle the client subscribed to.
+func (c *serverConn) push(curve [][]byte, result []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.subscribed["0203"] {
+		for _, f := range curve {
+			if err := c.send(f); err != nil {
+				return err
+			}
+		}
+	}
+	if c.subscribed["0202"] {
+		if err := c.send(result); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Frame encodes a frame with raw data, e.g. Frame(danikor.ModeAck, "0001",
+// "ACK").
+func Frame(mode byte, mid, data string) []byte {
+	body := string(mode) + mid + data
+	f := make([]byte, 0, len(body)+6)
+	f = append(f, 0x02)
+	f = binary.BigEndian.AppendUint32(f, uint32(len(body)))
+	f = append(f, body...)
+	return append(f, 0x03)
+}
+
+var errDisconnected = errors.New("danikortest: connection dropped by fault")
@@ -0,0 +1,212 @@
+package danikortest
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/linexjlin/danikor"
+)
+
+func dial(t *testing.T, s *Server) *danikor.DanikorTCPConnection {
+	t.Helper()
+	dc := danikor.NewDanikorTCPConnection(s.Addr(), nil)
+	if err := dc.DialContext(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { dc.Close() })
+	return dc
+}
+
+func nextCycle(t *testing.T, cycles <-chan *danikor.TighteningCycle) *danikor.TighteningCycle {
+	t.Helper()
+	select {
+	case c := <-cycles:
+		return c
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for a cycle")
+		return nil
+	}
+}
+
+func TestServerCycle(t *testing.T) {
+	s := NewServer(WithSamples(90, 40))
+	defer s.Close()
+	dc := dial(t, s)
+	ctx := context.Background()
+	cycles, cancel := dc.Cycles()
+	defer cancel()
+
+	if _, err := dc.Establish(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := dc.ChosePset(ctx, 3); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := dc.SubscribeRealTimeData(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := dc.SubscribeResultData(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := dc.ForwardTurn(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	c := nextCycle(t, cycles)
+	if c.Curve == nil || len(c.Curve.Torque) != 90 || c.Curve.Pset != "3" || c.Curve.SampleInterval != SampleInterval {
+		t.Fatalf("got curve %+v", c.Curve)
+	}
+	r := c.Result
+	if r == nil || !r.FinalStatus.OK() || r.FinalTorqueValue != 5 || r.FinalAngleMonitor != 900 || len(r.Stages) != 2 {
+		t.Fatalf("got result %+v", r)
+	}
+	if last := c.Curve.Torque[len(c.Curve.Torque)-1]; last != r.FinalTorqueValue {
+		t.Fatalf("curve ends at %v, result says %v", last, r.FinalTorqueValue)
+	}
+
+	var mids []string
+	for _, req := range s.Requests() {
+		mids = append(mids, req.String())
+	}
+	want := []string{"R0001", "W010301=3;", "R0203", "R0202", "W030101=1;"}
+	if len(mids) != len(want) {
+		t.Fatalf("got requests %q, want %q", mids, want)
+	}
+	for i := range want {
+		if mids[i] != want[i] {
+			t.Fatalf("got requests %q, want %q", mids, want)
+		}
+	}
+}
+
+// capturedResult is a 0202 frame captured from a real controller, five
+// stages long.
+const capturedResult = "02000000da543032303230303031303d302e3031322c302e3030302c332e3030302c313235372e3036393b30303031313d323b30303031323d35323b30313031303d302e3030302c302e3030302c302e3030303b30313031313d313b30313032303d302e3030302c302e3030302c302e3030303b30313032313d313b30313033303d302e3030302c302e3030302c302e3030303b30313033313d313b30313034303d302e3030302c302e3030302c302e3030303b30313034313d313b30313035303d302e3031322c313235372e3036392c332e3030303b30313035313d363b03"
+
+// resultKeys lists the keys of the data of a 0202 frame, in order.
+func resultKeys(t *testing.T, frame []byte) []string {
+	t.Helper()
+	var ans danikor.AnsData
+	if err := ans.UnmarshalBinary(frame); err != nil {
+		t.Fatal(err)
+	}
+	var keys []string
+	for _, pair := range strings.Split(strings.TrimSuffix(string(ans.Data), ";"), ";") {
+		key, _, _ := strings.Cut(pair, "=")
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+func TestServerResultLayout(t *testing.T) {
+	p := DefaultPset
+	p.Stages = nil
+	for k := 1; k <= 5; k++ {
+		p.Stages = append(p.Stages, danikor.StageSetting{Index: k, TargetTorque: float64(k), Speed: 100, AngleMax: 360})
+	}
+	s := NewServer(WithPset(1, p))
+	defer s.Close()
+
+	captured, err := hex.DecodeString(capturedResult)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, result := s.cycle()
+	got, want := resultKeys(t, result), resultKeys(t, captured)
+	if strings.Join(got, ";") != strings.Join(want, ";") {
+		t.Fatalf("got result keys %q, want %q as the controller sends", got, want)
+	}
+}
+
+func TestServerEstablishRequired(t *testing.T) {
+	s := NewServer(WithEstablishRequired())
+	defer s.Close()
+	dc := dial(t, s)
+	ctx := context.Background()
+
+	if _, err := dc.ChosePset(ctx, 2); !errors.Is(err, danikor.ErrNak) {
+		t.Fatalf("got %v before the establish, want ErrNak", err)
+	}
+	if _, err := dc.Establish(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := dc.ChosePset(ctx, 2); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestServerNg(t *testing.T) {
+	s := NewServer(WithTightening(func(pset int, p danikor.Pset) Tightening {
+		return Tightening{FinalTorque: p.TorqueMax + 1, FinalAngle: p.AngleMin}
+	}))
+	defer s.Close()
+	dc := dial(t, s)
+	ctx := context.Background()
+	results, cancel := dc.Results()
+	defer cancel()
+	if _, err := dc.SubscribeResultData(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	s.Tighten()
+	select {
+	case r := <-results:
+		reason := r.NgCode.Reason()
+		if !r.FinalStatus.NG() || reason.Kind != danikor.NgTorqueHigh || r.Stages[1].Status != danikor.StageTorqueHigh {
+			t.Fatalf("got result %+v, reason %v", r, reason)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for the result")
+	}
+}
+
+func TestServerPsetAndTool(t *testing.T) {
+	var mu sync.Mutex
+	var hooked []string
+	s := NewServer(WithRequestHook(func(req danikor.Request) {
+		mu.Lock()
+		hooked = append(hooked, req.MID)
+		mu.Unlock()
+	}))
+	defer s.Close()
+	dc := dial(t, s)
+	ctx := context.Background()
+
+	p, err := dc.GetPset(ctx, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.TargetTorque != DefaultPset.TargetTorque || len(p.Stages) != len(DefaultPset.Stages) {
+		t.Fatalf("got pset %+v", p)
+	}
+	p.TargetTorque, p.TorqueMax = 6, 6.5
+	if _, err := dc.SetPset(ctx, 1, p); err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := s.Param("1101", "01"); v != "6.000" {
+		t.Fatalf("target torque %q after SetPset", v)
+	}
+
+	if _, err := dc.ChosePset(ctx, 1); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := dc.DisableTool(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := dc.ForwardTurn(ctx); !errors.Is(err, danikor.ErrNak) {
+		t.Fatalf("forward turn with the tool disabled: %v", err)
+	}
+	if _, err := dc.Do(ctx, danikor.NewRequest(danikor.ModeRead, "9999")); !errors.Is(err, danikor.ErrNak) {
+		t.Fatalf("unknown MID: %v", err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(hooked) != len(s.Requests()) {
+		t.Fatalf("hook saw %d requests, server %d", len(hooked), len(s.Requests()))
+	}
+}
@@ -0,0 +1,73 @@
+package danikor
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"net"
+	"time"
+)
+
+// Dial defaults, see WithConnectTimeout and WithBackoff.
+const (
+	DefaultConnectTimeout = 5 * time.Second
+	DefaultMinBackoff     = time.Second
+	DefaultMaxBackoff     = 30 * time.Second
+)
+
+// backoff is the delay schedule between dial attempts: it doubles from min
+// up to max and each delay is spread by ±20% so a line of tools restarted
+// together does not redial in lockstep.
+type backoff struct {
+	min, max time.Duration
+}
+
+func (b backoff) delay(attempt int) time.Duration {
+	d := b.min
+	for i := 1; i < attempt && d < b.max; i++ {
+		d *= 2
+	}
+	if d > b.max {
+		d = b.max
+	}
+	jitter := time.Duration(rand.Int63n(int64(d)/5*2+1)) - d/5
+	return d + jitter
+}
+
+// DialContext connects to the controller, retrying with exponential backoff
+// until it succeeds, ctx is done or the attempt limit is reached. Every
+// failed attempt is passed to the hook set with WithDialErrorHook.
+func (dc *DanikorTCPConnection) DialContext(ctx context.Context) error {
+	dialer := net.Dialer{Timeout: dc.connectTimeout}
+	for attempt := 1; ; attempt++ {
+		conn, err := dialer.DialContext(ctx, "tcp", dc.address)
+		if err == nil {
+			dc.attach(conn)
+			return nil
+		}
+		dc.logger.Warn("danikor: dial failed", "addr", dc.address, "attempt", attempt, "err", err)
+		if dc.dialErrorHook != nil {
+			dc.dialErrorHook(attempt, err)
+		}
+		if ctx.Err() != nil {
+			return fmt.Errorf("danikor: dial %s: %w", dc.address, ctx.Err())
+		}
+		if dc.maxAttempts > 0 && attempt >= dc.maxAttempts {
+			return fmt.Errorf("danikor: dial %s: giving up after %d attempts: %w", dc.address, attempt, err)
+		}
+
+		timer := time.NewTimer(dc.backoff.delay(attempt))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return fmt.Errorf("danikor: dial %s: %w", dc.address, ctx.Err())
+		case <-timer.C:
+		}
+	}
+}
+
+// Dial is DialContext without a way to cancel it. It only fails when an
+// attempt limit is set.
+func (dc *DanikorTCPConnection) Dial() error {
+	return dc.DialContext(context.Background())
+}
@@ -0,0 +1,42 @@
+package danikor
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Errors returned by AnsData.UnmarshalBinary. They are wrapped with details
+// about the offending frame, use errors.Is to test for them.
+var (
+	ErrTruncated      = errors.New("danikor: frame truncated")
+	ErrBadHeader      = errors.New("danikor: bad frame header")
+	ErrBadTailer      = errors.New("danikor: bad frame tailer")
+	ErrLengthMismatch = errors.New("danikor: frame length mismatch")
+	ErrBadMode        = errors.New("danikor: unknown frame mode")
+	ErrBadMID         = errors.New("danikor: malformed MID")
+	ErrBadValue       = errors.New("danikor: malformed value")
+	ErrMissingParam   = errors.New("danikor: parameter missing")
+)
+
+// ProtocolError is reported when a received frame cannot be decoded. The
+// connection keeps running; the frame is dropped.
+type ProtocolError struct {
+	Frame []byte
+	Err   error
+}
+
+func (e *ProtocolError) Error() string {
+	return fmt.Sprintf("%v (frame %x)", e.Err, e.Frame)
+}
+
+func (e *ProtocolError) Unwrap() error {
+	return e.Err
+}
+
+// Errors returned by commands.
+var (
+	ErrNotConnected = errors.New("danikor: not connected")
+	ErrClosed       = errors.New("danikor: connection closed")
+	ErrNak          = errors.New("danikor: request rejected by controller")
+	ErrLinkDead     = errors.New("danikor: link dead")
+)
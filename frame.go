@@ -0,0 +1,134 @@
+package danikor
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+)
+
+const (
+	frameHeader byte = 0x02
+	frameTailer byte = 0x03
+
+	// MaxFrameLen bounds the DataLen field accepted by FrameReader, so a
+	// garbled length cannot make the reader allocate or wait for megabytes.
+	MaxFrameLen = 64 * 1024
+)
+
+// FrameReader splits a byte stream into Danikor frames.
+//
+// A frame is 0x02, a 4 byte big endian DataLen, DataLen bytes of body
+// (mode, MID and data) and a 0x03 tailer. Several frames in one read and
+// one frame spread over several reads are both handled; bytes that do not
+// start a valid frame are skipped until the next 0x02.
+type FrameReader struct {
+	r   io.Reader
+	buf []byte
+
+	// discard, if set, gets the bytes skipped as not part of a frame, so the
+	// recorder can keep them too
+	discard func([]byte)
+	skipped []byte
+}
+
+func NewFrameReader(r io.Reader) *FrameReader {
+	return &FrameReader{r: r, buf: make([]byte, 0, 1024)}
+}
+
+// ReadFrame blocks until one complete frame is available and returns it,
+// header and tailer included. The returned slice is owned by the caller.
+func (fr *FrameReader) ReadFrame() ([]byte, error) {
+	for {
+		if frame, ok := fr.next(); ok {
+			return frame, nil
+		}
+		if err := fr.fill(); err != nil {
+			if err == io.EOF && len(fr.buf) > 0 {
+				err = io.ErrUnexpectedEOF
+			}
+			if len(fr.buf) > 0 {
+				// a frame cut short by the end of the stream
+				fr.skip(len(fr.buf))
+				fr.flushSkipped()
+			}
+			return nil, err
+		}
+	}
+}
+
+// next cuts the first complete frame out of the buffer. It drops garbage in
+// front of a header and reports false when more bytes are needed.
+func (fr *FrameReader) next() ([]byte, bool) {
+	defer fr.flushSkipped()
+	for {
+		i := bytes.IndexByte(fr.buf, frameHeader)
+		if i < 0 {
+			fr.skip(len(fr.buf))
+			return nil, false
+		}
+		fr.skip(i)
+		if len(fr.buf) < 5 {
+			return nil, false
+		}
+
+		dataLen := binary.BigEndian.Uint32(fr.buf[1:5])
+		if dataLen == 0 || dataLen > MaxFrameLen {
+			fr.skip(1)
+			continue
+		}
+		size := 1 + 4 + int(dataLen) + 1
+		if len(fr.buf) < size {
+			return nil, false
+		}
+		if fr.buf[size-1] != frameTailer {
+			// the 0x02 was not a real header, rescan from the next byte
+			fr.skip(1)
+			continue
+		}
+
+		frame := make([]byte, size)
+		copy(frame, fr.buf[:size])
+		fr.buf = fr.buf[size:]
+		return frame, true
+	}
+}
+
+// skip drops the first n bytes of the buffer.
+func (fr *FrameReader) skip(n int) {
+	if fr.discard != nil && n > 0 {
+		fr.skipped = append(fr.skipped, fr.buf[:n]...)
+	}
+	fr.buf = fr.buf[n:]
+}
+
+// flushSkipped hands the skipped bytes to discard in pieces of at most
+// MaxFrameLen, so a capture line of them is no longer than one of a frame.
+func (fr *FrameReader) flushSkipped() {
+	for len(fr.skipped) > 0 {
+		n := len(fr.skipped)
+		if n > MaxFrameLen {
+			n = MaxFrameLen
+		}
+		fr.discard(fr.skipped[:n])
+		fr.skipped = fr.skipped[n:]
+	}
+	fr.skipped = nil
+}
+
+func (fr *FrameReader) fill() error {
+	if cap(fr.buf)-len(fr.buf) < 512 {
+		size := 2 * len(fr.buf)
+		if size < 1024 {
+			size = 1024
+		}
+		grown := make([]byte, len(fr.buf), size)
+		copy(grown, fr.buf)
+		fr.buf = grown
+	}
+	n, err := fr.r.Read(fr.buf[len(fr.buf):cap(fr.buf)])
+	fr.buf = fr.buf[:len(fr.buf)+n]
+	if n > 0 {
+		return nil
+	}
+	return err
+}
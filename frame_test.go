@@ -0,0 +1,78 @@
+package danikor
+
+import (
+	"bytes"
+	"encoding/hex"
+	"io"
+	"testing"
+)
+
+// chunkReader hands out its data in fixed size pieces, like a busy TCP link.
+type chunkReader struct {
+	data  []byte
+	chunk int
+}
+
+func (c *chunkReader) Read(p []byte) (int, error) {
+	if len(c.data) == 0 {
+		return 0, io.EOF
+	}
+	n := c.chunk
+	if n > len(c.data) {
+		n = len(c.data)
+	}
+	if n > len(p) {
+		n = len(p)
+	}
+	copy(p, c.data[:n])
+	c.data = c.data[n:]
+	return n, nil
+}
+
+func mustHex(t *testing.T, s string) []byte {
+	t.Helper()
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestFrameReader(t *testing.T) {
+	ack := mustHex(t, "0200000008413030303141434b03")
+	curve := mustHex(t, "02000000395430323033303130313d352c303b303130323d313b303230313d303b303230323d313b303330313d302e3030303b303330323d302e3030303b03")
+	long := append([]byte{0x02, 0x00, 0x00, 0x07, 0xD5, 'T', '0', '2', '0', '3'}, bytes.Repeat([]byte{'1'}, 2000)...)
+	long = append(long, 0x03)
+
+	var stream []byte
+	stream = append(stream, 0xFF, 0x00) // line noise before the first frame
+	stream = append(stream, ack...)
+	stream = append(stream, curve...)
+	stream = append(stream, 0x02, 0x00, 0x00, 0x00, 0x05, 'R', '0', '0') // header without a tailer
+	stream = append(stream, long...)
+	stream = append(stream, ack...)
+
+	want := [][]byte{ack, curve, long, ack}
+	for _, chunk := range []int{1, 7, 64, 4096} {
+		fr := NewFrameReader(&chunkReader{data: stream, chunk: chunk})
+		for i, w := range want {
+			got, err := fr.ReadFrame()
+			if err != nil {
+				t.Fatalf("chunk %d frame %d: %v", chunk, i, err)
+			}
+			if !bytes.Equal(got, w) {
+				t.Fatalf("chunk %d frame %d: got %x, want %x", chunk, i, got, w)
+			}
+		}
+		if _, err := fr.ReadFrame(); err != io.EOF {
+			t.Fatalf("chunk %d: got %v at end of stream, want EOF", chunk, err)
+		}
+	}
+}
+
+func TestFrameReaderTruncated(t *testing.T) {
+	fr := NewFrameReader(bytes.NewReader(mustHex(t, "02000000084130303031")))
+	if _, err := fr.ReadFrame(); err != io.ErrUnexpectedEOF {
+		t.Fatalf("got %v, want io.ErrUnexpectedEOF", err)
+	}
+}
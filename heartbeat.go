@@ -0,0 +1,50 @@
+package danikor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+)
+
+// DefaultHeartbeatMID is read by the heartbeat unless WithHeartbeatMID says
+// otherwise. The MID 0001 establish is cheap and acked by every controller.
+const DefaultHeartbeatMID = "0001"
+
+// heartbeat reads the heartbeat MID every interval while conn is up. After
+// maxMissed unanswered reads in a row the link is considered dead and conn
+// is closed, which ends the reader and lets Run reconnect.
+func (dc *DanikorTCPConnection) heartbeat(conn net.Conn, done chan struct{}) {
+	ticker := time.NewTicker(dc.heartbeatInterval)
+	defer ticker.Stop()
+
+	missed := 0
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), dc.heartbeatInterval)
+		_, err := dc.Do(ctx, NewRequest(ModeRead, dc.heartbeatMID))
+		cancel()
+		if err == nil || errors.Is(err, ErrNak) {
+			// any answer proves the link is alive
+			missed = 0
+			continue
+		}
+		if errors.Is(err, ErrClosed) {
+			return
+		}
+
+		missed++
+		dc.logger.Warn("danikor: heartbeat missed", "addr", dc.address, "missed", missed, "err", err)
+		if missed >= dc.heartbeatMaxMissed {
+			dc.reportError(fmt.Errorf("%w: %d heartbeats missed: %v", ErrLinkDead, missed, err))
+			conn.Close()
+			return
+		}
+	}
+}
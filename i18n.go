@@ -0,0 +1,138 @@
+package danikor
+
+import "fmt"
+
+// Localizer turns result codes into text for an operator. Implement it, or
+// fill a Catalog, to add a language; set it with WithLocalizer.
+type Localizer interface {
+	FinalStatus(FinalStatus) string
+	NgReason(NgReason) string
+	StageStatus(StageStatus) string
+}
+
+// Language selects a built-in catalog.
+type Language string
+
+const (
+	Chinese Language = "zh"
+	English Language = "en"
+)
+
+// Catalog is a Localizer backed by one message table per code type.
+type Catalog struct {
+	FinalStatuses map[FinalStatus]string
+	// NgFinal holds the text of NG reasons about the final values or the
+	// whole cycle, NgStage printf formats taking the stage number.
+	NgFinal       map[NgKind]string
+	NgStage       map[NgKind]string
+	StageStatuses map[StageStatus]string
+	Unknown       string // used for codes missing from the tables
+}
+
+func (c *Catalog) FinalStatus(s FinalStatus) string {
+	if text, ok := c.FinalStatuses[s]; ok {
+		return text
+	}
+	return c.Unknown
+}
+
+func (c *Catalog) NgReason(r NgReason) string {
+	if r.Stage > 0 {
+		if format, ok := c.NgStage[r.Kind]; ok {
+			return fmt.Sprintf(format, r.Stage)
+		}
+		return c.Unknown
+	}
+	if text, ok := c.NgFinal[r.Kind]; ok {
+		return text
+	}
+	return c.Unknown
+}
+
+func (c *Catalog) StageStatus(s StageStatus) string {
+	if text, ok := c.StageStatuses[s]; ok {
+		return text
+	}
+	return c.Unknown
+}
+
+var catalogs = map[Language]*Catalog{
+	Chinese: {
+		FinalStatuses: map[FinalStatus]string{
+			FinalStatusUndefined: "无定意",
+			FinalStatusOK:        "OK，拧紧合格",
+			FinalStatusNG:        "NG，拧紧不合格",
+		},
+		NgFinal: map[NgKind]string{
+			NgNone:       "无定意",
+			NgTorqueHigh: "最终扭矩过大",
+			NgTorqueLow:  "最终扭矩过小",
+			NgAngleHigh:  "最终角度过大",
+			NgAngleLow:   "最终角度过小",
+			NgOvertime:   "总时间超限",
+		},
+		NgStage: map[NgKind]string{
+			NgTorqueHigh: "第 %d 步扭矩过大",
+			NgTorqueLow:  "第 %d 步扭矩过小",
+		},
+		StageStatuses: map[StageStatus]string{
+			StageUndefined:  "无定意",
+			StageOK:         "OK",
+			StageTorqueHigh: "扭矩过大",
+			StageTorqueLow:  "扭矩过小",
+			StageAngleHigh:  "角度过大",
+			StageAngleLow:   "角度过小",
+			StageTimeLong:   "时间过长",
+			StageTimeShort:  "时间过短",
+		},
+		Unknown: "未知状态",
+	},
+	English: {
+		FinalStatuses: map[FinalStatus]string{
+			FinalStatusUndefined: "undefined",
+			FinalStatusOK:        "OK",
+			FinalStatusNG:        "NG",
+		},
+		NgFinal: map[NgKind]string{
+			NgNone:       "none",
+			NgTorqueHigh: "final torque too high",
+			NgTorqueLow:  "final torque too low",
+			NgAngleHigh:  "final angle too high",
+			NgAngleLow:   "final angle too low",
+			NgOvertime:   "total time exceeded",
+		},
+		NgStage: map[NgKind]string{
+			NgTorqueHigh: "stage %d torque too high",
+			NgTorqueLow:  "stage %d torque too low",
+		},
+		StageStatuses: map[StageStatus]string{
+			StageUndefined:  "undefined",
+			StageOK:         "OK",
+			StageTorqueHigh: "torque too high",
+			StageTorqueLow:  "torque too low",
+			StageAngleHigh:  "angle too high",
+			StageAngleLow:   "angle too low",
+			StageTimeLong:   "time too long",
+			StageTimeShort:  "time too short",
+		},
+		Unknown: "unknown",
+	},
+}
+
+// NewLocalizer returns the built-in catalog for lang, English if there is
+// none.
+func NewLocalizer(lang Language) Localizer {
+	if c, ok := catalogs[lang]; ok {
+		return c
+	}
+	return catalogs[English]
+}
+
+// defaultLocalizer is used by the Show methods of results that did not come
+// through a connection with WithLocalizer.
+var defaultLocalizer = NewLocalizer(Chinese)
+
+func (s FinalStatus) String() string { return catalogs[English].FinalStatus(s) }
+func (r NgReason) String() string    { return catalogs[English].NgReason(r) }
+func (c NgCode) String() string      { return c.Reason().String() }
+func (s StageStatus) String() string { return catalogs[English].StageStatus(s) }
@@ -0,0 +1,85 @@
+package danikor
+
+import (
+	"net"
+	"testing"
+)
+
+func TestLocalizer(t *testing.T) {
+	zh, en := NewLocalizer(Chinese), NewLocalizer(English)
+	tests := []struct {
+		code   NgCode
+		zh, en string
+	}{
+		{0x00, "无定意", "none"},
+		{0x01, "最终扭矩过大", "final torque too high"},
+		{0x02, "最终扭矩过小", "final torque too low"},
+		{0x03, "最终角度过大", "final angle too high"},
+		{0x04, "最终角度过小", "final angle too low"},
+		{0x31, "第 3 步扭矩过大", "stage 3 torque too high"},
+		{0x32, "第 3 步扭矩过小", "stage 3 torque too low"},
+		{0x90, "总时间超限", "total time exceeded"},
+		{0x07, "未知状态", "unknown"},
+	}
+	for _, tt := range tests {
+		if got := zh.NgReason(tt.code.Reason()); got != tt.zh {
+			t.Errorf("zh %#x: got %q, want %q", tt.code, got, tt.zh)
+		}
+		if got := en.NgReason(tt.code.Reason()); got != tt.en {
+			t.Errorf("en %#x: got %q, want %q", tt.code, got, tt.en)
+		}
+		if got := tt.code.String(); got != tt.en {
+			t.Errorf("String %#x: got %q, want %q", tt.code, got, tt.en)
+		}
+	}
+
+	if got := FinalStatusNG.String(); got != "NG" {
+		t.Errorf("FinalStatus.String: got %q", got)
+	}
+	if got := StageTimeLong.String(); got != "time too long" {
+		t.Errorf("StageStatus.String: got %q", got)
+	}
+	if got := zh.StageStatus(StageAngleLow); got != "角度过小" {
+		t.Errorf("zh StageStatus: got %q", got)
+	}
+}
+
+func TestWithLocalizer(t *testing.T) {
+	german := &Catalog{
+		FinalStatuses: map[FinalStatus]string{FinalStatusNG: "n.i.O."},
+		NgStage:       map[NgKind]string{NgTorqueLow: "Stufe %d Drehmoment zu niedrig"},
+		Unknown:       "unbekannt",
+	}
+
+	client, server := net.Pipe()
+	defer server.Close()
+	results := make(chan *DanitorTorqueResult, 1)
+	dc := NewDanikorTCPConnection("", func(ansData AnsData) {
+		if ansData.TorqueResult != nil {
+			results <- ansData.TorqueResult
+		}
+	}, WithLocalizer(german))
+	dc.attach(client)
+	defer dc.Close()
+
+	go sendHexString(server, testResultFrame)
+	r := <-results
+	if got := r.ShowFinalStatus(); got != "n.i.O." {
+		t.Errorf("ShowFinalStatus: got %q", got)
+	}
+	if got := r.ShowNgCode(); got != "Stufe 5 Drehmoment zu niedrig" {
+		t.Errorf("ShowNgCode: got %q", got)
+	}
+	if got := r.ShowStageStatus(StageOK); got != "unbekannt" {
+		t.Errorf("ShowStageStatus: got %q", got)
+	}
+
+	// results parsed outside a connection keep the Chinese default
+	standalone, err := parseTorqueResult("00011=2;00012=02;")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := standalone.ShowNgCode(); got != "最终扭矩过小" {
+		t.Errorf("default ShowNgCode: got %q", got)
+	}
+}
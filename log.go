@@ -0,0 +1,34 @@
+package danikor
+
+import "encoding/hex"
+
+// Logger receives the library's diagnostics. Its method set matches
+// *slog.Logger, so one can be passed directly to WithLogger. Without a
+// logger nothing is written anywhere.
+type Logger interface {
+	Debug(msg string, args ...any)
+	Info(msg string, args ...any)
+	Warn(msg string, args ...any)
+	Error(msg string, args ...any)
+}
+
+type nopLogger struct{}
+
+func (nopLogger) Debug(string, ...any) {}
+func (nopLogger) Info(string, ...any)  {}
+func (nopLogger) Warn(string, ...any)  {}
+func (nopLogger) Error(string, ...any) {}
+
+// hexFrame defers hex encoding a frame until a logger actually prints it.
+// Loggers that format with fmt use String; slog handlers use MarshalText,
+// without which they print the raw bytes or base64.
+type hexFrame []byte
+
+func (f hexFrame) String() string {
+	return hex.EncodeToString(f)
+}
+
+// MarshalText implements the encoding.TextMarshaler interface.
+func (f hexFrame) MarshalText() ([]byte, error) {
+	return []byte(hex.EncodeToString(f)), nil
+}
@@ -0,0 +1,28 @@
+//go:build go1.21
+
+package danikor
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestHexFrameSlog(t *testing.T) {
+	frame := hexFrame(mustHex(t, "0200000008413030303141434b03"))
+
+	var text bytes.Buffer
+	slog.New(slog.NewTextHandler(&text, nil)).Info("danikor: frame received", "frame", frame)
+	if !strings.Contains(text.String(), "frame=0200000008413030303141434b03") {
+		t.Fatalf("text handler wrote %q", text.String())
+	}
+
+	var buf bytes.Buffer
+	slog.New(slog.NewJSONHandler(&buf, nil)).Info("danikor: frame received", "frame", frame)
+	var line struct{ Frame string }
+	if err := json.Unmarshal(buf.Bytes(), &line); err != nil || line.Frame != "0200000008413030303141434b03" {
+		t.Fatalf("json handler wrote %q: %v", buf.String(), err)
+	}
+}
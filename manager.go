@@ -0,0 +1,201 @@
+package danikor
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// Station is one controller of a line as configured for a Manager.
+type Station struct {
+	ID      string   `json:"id"`
+	Address string   `json:"address"`
+	Options []Option `json:"-"` // applied after the options common to all stations
+}
+
+// ReadStations reads a station list written as JSON, e.g.
+//
+//	[{"id": "op10", "address": "192.168.2.5:5000"}]
+func ReadStations(r io.Reader) ([]Station, error) {
+	var stations []Station
+	if err := json.NewDecoder(r).Decode(&stations); err != nil {
+		return nil, err
+	}
+	return stations, nil
+}
+
+// StationEvent is an event of one station: an AnsData, *Curve or
+// *TighteningCycle as published to the subscriptions of its connection.
+type StationEvent struct {
+	Station string
+	Event   any
+}
+
+// Health is the state of one station as seen by its Manager.
+type Health struct {
+	Station    string
+	Address    string
+	State      ConnState
+	Since      time.Time // when State was entered, zero before Run
+	LastResult time.Time // when the last 0202 result arrived, zero if none
+	LastError  error     // last error reported by the connection or its dialing, if any
+}
+
+// Connected reports whether the station has a working session.
+func (h Health) Connected() bool {
+	return h.State == StateConnected || h.State == StateRestored
+}
+
+// Manager owns the connections to all controllers of a line. Run supervises
+// them, Events merges their events tagged with the station ID and Health
+// reports on each of them.
+type Manager struct {
+	ids      []string // in configuration order
+	stations map[string]*managedStation
+	hub      hub
+	cancels  []func()
+}
+
+type managedStation struct {
+	dc *DanikorTCPConnection
+
+	mu     sync.Mutex
+	health Health
+}
+
+// NewManager creates a connection per station; opts apply to each of them.
+// State and error callbacks and dial error hooks given in the options still
+// run, after the manager has taken note. Station IDs must be unique.
+func NewManager(stations []Station, opts ...Option) (*Manager, error) {
+	m := &Manager{stations: make(map[string]*managedStation)}
+	for _, st := range stations {
+		if st.ID == "" {
+			return nil, fmt.Errorf("danikor: station %s has no ID", st.Address)
+		}
+		if m.stations[st.ID] != nil {
+			return nil, fmt.Errorf("danikor: duplicate station ID %q", st.ID)
+		}
+		dc := NewDanikorTCPConnection(st.Address, nil, append(append([]Option(nil), opts...), st.Options...)...)
+		ms := &managedStation{dc: dc, health: Health{Station: st.ID, Address: st.Address}}
+
+		stateCallBack, errorCallBack, dialErrorHook := dc.stateCallBack, dc.errorCallBack, dc.dialErrorHook
+		dc.stateCallBack = func(s ConnState) {
+			ms.mu.Lock()
+			ms.health.State = s
+			ms.health.Since = time.Now()
+			ms.mu.Unlock()
+			if stateCallBack != nil {
+				stateCallBack(s)
+			}
+		}
+		dc.errorCallBack = func(err error) {
+			ms.mu.Lock()
+			ms.health.LastError = err
+			ms.mu.Unlock()
+			if errorCallBack != nil {
+				errorCallBack(err)
+			}
+		}
+		dc.dialErrorHook = func(attempt int, err error) {
+			ms.mu.Lock()
+			ms.health.LastError = err
+			ms.mu.Unlock()
+			if dialErrorHook != nil {
+				dialErrorHook(attempt, err)
+			}
+		}
+
+		events, cancel := subscribe(&dc.hub, func(any) bool { return true }, func(ev any) any { return ev }, []SubscribeOption{WithPolicy(Block)})
+		go m.forward(st.ID, ms, events)
+
+		m.ids = append(m.ids, st.ID)
+		m.stations[st.ID] = ms
+		m.cancels = append(m.cancels, cancel)
+	}
+	return m, nil
+}
+
+// forward tags the events of one station and publishes them.
+func (m *Manager) forward(id string, ms *managedStation, events <-chan any) {
+	for ev := range events {
+		if ansData, ok := ev.(AnsData); ok && ansData.AnsMode == ModeTransmit && ansData.MID == "0202" {
+			ms.mu.Lock()
+			ms.health.LastResult = time.Now()
+			ms.mu.Unlock()
+		}
+		m.hub.publish(StationEvent{Station: id, Event: ev})
+	}
+}
+
+// Stations returns the station IDs in configuration order.
+func (m *Manager) Stations() []string {
+	return append([]string(nil), m.ids...)
+}
+
+// Station returns the connection of station id, nil if there is none. Use
+// it to send commands, the manager keeps it connected.
+func (m *Manager) Station(id string) *DanikorTCPConnection {
+	if ms := m.stations[id]; ms != nil {
+		return ms.dc
+	}
+	return nil
+}
+
+// Health returns the health of every station in configuration order.
+func (m *Manager) Health() []Health {
+	health := make([]Health, 0, len(m.ids))
+	for _, id := range m.ids {
+		ms := m.stations[id]
+		ms.mu.Lock()
+		health = append(health, ms.health)
+		ms.mu.Unlock()
+	}
+	return health
+}
+
+// Events subscribes to the events of every station, see StationEvent.
+func (m *Manager) Events(opts ...SubscribeOption) (<-chan StationEvent, func()) {
+	accept := func(ev any) bool {
+		_, ok := ev.(StationEvent)
+		return ok
+	}
+	return subscribe(&m.hub, accept, func(ev any) StationEvent { return ev.(StationEvent) }, opts)
+}
+
+// Run runs every station's connection with Run until ctx is done. A station
+// whose dialing gives up does not stop the others; its error is returned,
+// joined with the others', once ctx is done.
+func (m *Manager) Run(ctx context.Context) error {
+	var wg sync.WaitGroup
+	errs := make([]error, len(m.ids))
+	for i, id := range m.ids {
+		wg.Add(1)
+		go func(i int, id string) {
+			defer wg.Done()
+			err := m.stations[id].dc.Run(ctx)
+			if err != nil && !errors.Is(err, ctx.Err()) {
+				errs[i] = fmt.Errorf("station %s: %w", id, err)
+			}
+		}(i, id)
+	}
+	wg.Wait()
+	if err := errors.Join(errs...); err != nil {
+		return err
+	}
+	return ctx.Err()
+}
+
+// Close ends the event forwarding of every station and closes their
+// connections. Call it once Run has returned.
+func (m *Manager) Close() {
+	for _, cancel := range m.cancels {
+		cancel()
+	}
+	for _, ms := range m.stations {
+		ms.dc.Close()
+	}
+}
@@ -0,0 +1,103 @@
+package danikor_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/linexjlin/danikor"
+	"github.com/linexjlin/danikor/danikortest"
+)
+
+func TestManager(t *testing.T) {
+	servers := map[string]*danikortest.Server{}
+	config := `[`
+	for i, id := range []string{"op10", "op20"} {
+		s := danikortest.NewServer()
+		defer s.Close()
+		servers[id] = s
+		if i > 0 {
+			config += ","
+		}
+		config += `{"id": "` + id + `", "address": "` + s.Addr() + `"}`
+	}
+	// op30 is switched off
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	off := l.Addr().String()
+	l.Close()
+	config += `, {"id": "op30", "address": "` + off + `"}]`
+
+	stations, err := danikor.ReadStations(strings.NewReader(config))
+	if err != nil {
+		t.Fatal(err)
+	}
+	stations[2].Options = []danikor.Option{danikor.WithMaxAttempts(2)}
+	if _, err := danikor.NewManager(append(stations, stations[0])); err == nil {
+		t.Fatal("duplicate station ID accepted")
+	}
+	m, err := danikor.NewManager(stations,
+		danikor.WithBackoff(time.Millisecond, time.Millisecond),
+		danikor.WithErrorCallBack(func(error) {}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+	events, cancel := m.Events(danikor.WithBuffer(64))
+	defer cancel()
+
+	ctx, stop := context.WithCancel(context.Background())
+	runErr := make(chan error, 1)
+	go func() { runErr <- m.Run(ctx) }()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		h := m.Health()
+		if h[0].Connected() && h[1].Connected() && h[2].State == danikor.StateDisconnected && h[2].LastError != nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("stations did not settle: %+v", h)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	if _, err := m.Station("op20").SubscribeResultData(ctx); err != nil {
+		t.Fatal(err)
+	}
+	servers["op20"].Tighten()
+	for {
+		select {
+		case ev := <-events:
+			if _, ok := ev.Event.(danikor.AnsData); !ok {
+				continue
+			}
+			if ev.Station != "op20" {
+				t.Fatalf("got an event of %s", ev.Station)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("no event")
+		}
+		break
+	}
+	h := m.Health()
+	if h[0].LastResult != (time.Time{}) || h[1].LastResult.IsZero() {
+		t.Fatalf("last results %v %v", h[0].LastResult, h[1].LastResult)
+	}
+
+	stop()
+	err = <-runErr
+	if err == nil || !strings.Contains(err.Error(), "station op30") || errors.Is(err, context.Canceled) {
+		t.Fatalf("Run returned %v", err)
+	}
+	for _, h := range m.Health() {
+		if h.Connected() {
+			t.Fatalf("%s still connected after Run", h.Station)
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package danikor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+var ErrCycleInProgress = errors.New("danikor: tightening cycle in progress")
+
+// Direction is the turning direction of the spindle.
+type Direction int
+
+const (
+	Forward Direction = 1 // tighten
+	Reverse Direction = 2 // loosen
+)
+
+func (d Direction) String() string {
+	switch d {
+	case Forward:
+		return "forward"
+	case Reverse:
+		return "reverse"
+	}
+	return "Direction(" + strconv.Itoa(int(d)) + ")"
+}
+
+// MotionLayout says which writes move the spindle: key 01 of MID set to
+// Forward, Reverse or Stop, and the free run at FreeRunMID with the
+// Direction at key 01 and the speed at key 02.
+type MotionLayout struct {
+	MID                    string
+	Forward, Reverse, Stop string
+	FreeRunMID             string
+}
+
+// DefaultMotionLayout tightens with 0301 01=1, the frame the original SDK
+// sent. Reverse (01=2), stop (01=0) and the free run at 0302 follow the same
+// pattern but are not confirmed by the protocol documents or a capture:
+// check them against your controller's firmware before relying on Stop, and
+// pass a different layout with WithMotionLayout if they differ.
+var DefaultMotionLayout = MotionLayout{
+	MID:        "0301",
+	Forward:    "1",
+	Reverse:    "2",
+	Stop:       "0",
+	FreeRunMID: "0302",
+}
+
+type motionConfig struct {
+	force bool
+}
+
+// MotionOption configures a motion command.
+type MotionOption func(*motionConfig)
+
+// WithForce sends a motion command even while a tightening cycle is in
+// progress.
+func WithForce() MotionOption {
+	return func(c *motionConfig) {
+		c.force = true
+	}
+}
+
+// CycleInProgress reports whether the spindle is in the middle of a
+// tightening, i.e. a curve has started but its end fragment has not arrived.
+// It is only known while real time data is subscribed.
+func (dc *DanikorTCPConnection) CycleInProgress() bool {
+	return dc.assembler.InProgress()
+}
+
+// checkMotion refuses a motion command during a cycle unless it is forced.
+func (dc *DanikorTCPConnection) checkMotion(opts []MotionOption) error {
+	var cfg motionConfig
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	if !cfg.force && dc.CycleInProgress() {
+		return ErrCycleInProgress
+	}
+	return nil
+}
+
+// ReverseTurn starts loosening.
+func (dc *DanikorTCPConnection) ReverseTurn(ctx context.Context, opts ...MotionOption) (AnsData, error) {
+	if err := dc.checkMotion(opts); err != nil {
+		return AnsData{}, err
+	}
+	l := dc.motionLayout
+	return dc.Do(ctx, NewRequest(ModeWrite, l.MID, Param{"01", l.Reverse})) //mid 反转
+}
+
+// Stop stops the spindle. It is never refused for a running cycle.
+func (dc *DanikorTCPConnection) Stop(ctx context.Context) (AnsData, error) {
+	l := dc.motionLayout
+	return dc.Do(ctx, NewRequest(ModeWrite, l.MID, Param{"01", l.Stop})) //mid 停止
+}
+
+// FreeRun turns the spindle in direction at speed rpm for duration, without
+// a tightening program, e.g. to jog a screw during rework. It blocks until
+// the spindle is stopped again; the stop is sent even when ctx ends first,
+// and whenever the start went out but its ack did not come back clean.
+func (dc *DanikorTCPConnection) FreeRun(ctx context.Context, direction Direction, speed float64, duration time.Duration, opts ...MotionOption) error {
+	if direction != Forward && direction != Reverse {
+		return fmt.Errorf("danikor: free run direction %v", direction)
+	}
+	if speed <= 0 || duration <= 0 {
+		return fmt.Errorf("danikor: free run at %v rpm for %v", speed, duration)
+	}
+	if err := dc.checkMotion(opts); err != nil {
+		return err
+	}
+	_, sent, err := dc.do(ctx, NewRequest(ModeWrite, dc.motionLayout.FreeRunMID, //mid 自由运行
+		Param{"01", strconv.Itoa(int(direction))},
+		Param{"02", formatValue(speed)},
+	))
+	if err != nil {
+		if sent {
+			// the spindle may be turning anyway, stop it best effort
+			dc.Stop(context.Background())
+		}
+		return err
+	}
+
+	t := time.NewTimer(duration)
+	defer t.Stop()
+	select {
+	case <-t.C:
+	case <-ctx.Done():
+	}
+	// ctx may be over already, the stop gets its own timeout
+	_, stopErr := dc.Stop(context.Background())
+	if stopErr != nil {
+		return stopErr
+	}
+	return ctx.Err()
+}
@@ -0,0 +1,110 @@
+package danikor
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestMotionCommands(t *testing.T) {
+	addr, requests := ackServer(t, nil)
+	dc := NewDanikorTCPConnection(addr, nil)
+	ctx := context.Background()
+	if err := dc.DialContext(ctx); err != nil {
+		t.Fatal(err)
+	}
+	defer dc.Close()
+
+	if _, err := dc.ReverseTurn(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := dc.Stop(ctx); err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	if err := dc.FreeRun(ctx, Reverse, 120, 20*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed < 20*time.Millisecond {
+		t.Fatalf("free run stopped after %v", elapsed)
+	}
+	if err := dc.FreeRun(ctx, Direction(3), 120, time.Second); err == nil {
+		t.Fatal("direction 3 accepted")
+	}
+
+	// a curve has started: motion is refused, stop and forced motion are not
+	dc.assembler.Add(mustParse(t, testCurveFrame))
+	if _, err := dc.ForwardTurn(ctx); !errors.Is(err, ErrCycleInProgress) {
+		t.Fatalf("got %v, want ErrCycleInProgress", err)
+	}
+	if err := dc.FreeRun(ctx, Forward, 120, time.Millisecond); !errors.Is(err, ErrCycleInProgress) {
+		t.Fatalf("got %v, want ErrCycleInProgress", err)
+	}
+	if _, err := dc.Stop(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := dc.ReverseTurn(ctx, WithForce()); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"1 W030101=2;", "1 W030101=0;", "1 W030201=2;02=120.000;", "1 W030101=0;", "1 W030101=0;", "1 W030101=2;"}
+	for _, w := range want {
+		if got := <-requests; got != w {
+			t.Fatalf("got request %q, want %q", got, w)
+		}
+	}
+	select {
+	case got := <-requests:
+		t.Fatalf("unexpected request %q", got)
+	default:
+	}
+}
+
+func TestFreeRunStopsWithoutAck(t *testing.T) {
+	// the free run goes out but its ack never comes back
+	client, server := newPipeServer(t, func(req *Request) bool { return req.MID == "0302" })
+
+	dc := NewDanikorTCPConnection("", nil, WithTimeout(50*time.Millisecond))
+	dc.attach(client)
+	defer dc.Close()
+
+	if err := dc.FreeRun(context.Background(), Forward, 120, time.Second); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("got %v, want a timeout", err)
+	}
+	for _, w := range []string{"W030201=1;02=120.000;", "W030101=0;"} {
+		select {
+		case got := <-server.requests:
+			if got != w {
+				t.Fatalf("got request %q, want %q", got, w)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("no request %q", w)
+		}
+	}
+}
+
+func TestMotionLayout(t *testing.T) {
+	client, server := newPipeServer(t, nil)
+	dc := NewDanikorTCPConnection("", nil, WithMotionLayout(MotionLayout{
+		MID: "0311", Forward: "3", Reverse: "4", Stop: "9", FreeRunMID: "0312",
+	}))
+	dc.attach(client)
+	defer dc.Close()
+
+	ctx := context.Background()
+	if _, err := dc.ForwardTurn(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := dc.ReverseTurn(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := dc.FreeRun(ctx, Forward, 60, time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	for _, w := range []string{"W031101=3;", "W031101=4;", "W031201=1;02=60.000;", "W031101=9;"} {
+		if got := <-server.requests; got != w {
+			t.Fatalf("got request %q, want %q", got, w)
+		}
+	}
+}
@@ -0,0 +1,152 @@
+package danikor
+
+import (
+	"io"
+	"time"
+)
+
+// Option configures a DanikorTCPConnection, see NewDanikorTCPConnection.
+type Option func(*DanikorTCPConnection)
+
+// WithErrorCallBack sets the function that receives errors from the receive
+// loop, such as undecodable frames (*ProtocolError) or a broken connection.
+// Errors also go to the logger, see WithLogger.
+func WithErrorCallBack(fn func(error)) Option {
+	return func(dc *DanikorTCPConnection) {
+		dc.errorCallBack = fn
+	}
+}
+
+// WithTimeout sets how long commands wait for their ack when the context
+// they get has no deadline. Zero disables the timeout.
+func WithTimeout(d time.Duration) Option {
+	return func(dc *DanikorTCPConnection) {
+		dc.timeout = d
+	}
+}
+
+// WithConnectTimeout bounds a single TCP connect attempt.
+func WithConnectTimeout(d time.Duration) Option {
+	return func(dc *DanikorTCPConnection) {
+		dc.connectTimeout = d
+	}
+}
+
+// WithBackoff sets the delay after the first failed dial attempt and the
+// ceiling it doubles up to. Delays are jittered by ±20%.
+func WithBackoff(min, max time.Duration) Option {
+	return func(dc *DanikorTCPConnection) {
+		if max < min {
+			max = min
+		}
+		dc.backoff = backoff{min: min, max: max}
+	}
+}
+
+// WithMaxAttempts makes DialContext give up after n failed attempts. Zero,
+// the default, retries until the context is done.
+func WithMaxAttempts(n int) Option {
+	return func(dc *DanikorTCPConnection) {
+		dc.maxAttempts = n
+	}
+}
+
+// WithDialErrorHook sets a function called after every failed dial attempt,
+// for example to log it.
+func WithDialErrorHook(fn func(attempt int, err error)) Option {
+	return func(dc *DanikorTCPConnection) {
+		dc.dialErrorHook = fn
+	}
+}
+
+// WithStateCallBack sets the function that receives the connection state
+// changes reported by Run.
+func WithStateCallBack(fn func(ConnState)) Option {
+	return func(dc *DanikorTCPConnection) {
+		dc.stateCallBack = fn
+	}
+}
+
+// WithHeartbeat makes the connection read the heartbeat MID every interval
+// once it is up. After maxMissed unanswered heartbeats in a row an error
+// wrapping ErrLinkDead is reported and the connection is closed, so Run
+// reconnects and a plain StartReceiveData returns.
+func WithHeartbeat(interval time.Duration, maxMissed int) Option {
+	return func(dc *DanikorTCPConnection) {
+		if maxMissed < 1 {
+			maxMissed = 1
+		}
+		dc.heartbeatInterval = interval
+		dc.heartbeatMaxMissed = maxMissed
+	}
+}
+
+// WithHeartbeatMID sets the MID read by the heartbeat, DefaultHeartbeatMID
+// by default.
+func WithHeartbeatMID(mid string) Option {
+	return func(dc *DanikorTCPConnection) {
+		dc.heartbeatMID = mid
+	}
+}
+
+// WithLocalizer sets the language of the Show methods of the results this
+// connection delivers, e.g. WithLocalizer(NewLocalizer(English)). The
+// default is Chinese.
+func WithLocalizer(l Localizer) Option {
+	return func(dc *DanikorTCPConnection) {
+		dc.localizer = l
+	}
+}
+
+// WithLogger routes diagnostics to l: errors and connection state at error,
+// warn and info level, every raw frame sent and received at debug level.
+func WithLogger(l Logger) Option {
+	return func(dc *DanikorTCPConnection) {
+		if l == nil {
+			l = nopLogger{}
+		}
+		dc.logger = l
+	}
+}
+
+// WithPsetLayout sets where GetPset and SetPset find the pset settings,
+// DefaultPsetLayout by default.
+func WithPsetLayout(l PsetLayout) Option {
+	return func(dc *DanikorTCPConnection) {
+		dc.psetLayout = l
+	}
+}
+
+// WithMotionLayout sets the writes of ForwardTurn, ReverseTurn, Stop and
+// FreeRun, DefaultMotionLayout by default.
+func WithMotionLayout(l MotionLayout) Option {
+	return func(dc *DanikorTCPConnection) {
+		dc.motionLayout = l
+	}
+}
+
+// WithToolMID sets the MID EnableTool, DisableTool and QueryToolState use,
+// DefaultToolMID by default.
+func WithToolMID(mid string) Option {
+	return func(dc *DanikorTCPConnection) {
+		dc.toolMID = mid
+	}
+}
+
+// WithToolFailSafe makes Run lock the tool first thing on every session it
+// starts, so a tool is never left enabled across a lost link: the host has
+// to call EnableTool again once its interlock conditions hold. Without it,
+// Run re-applies the last EnableTool or DisableTool.
+func WithToolFailSafe() Option {
+	return func(dc *DanikorTCPConnection) {
+		dc.toolFailSafe = true
+	}
+}
+
+// WithRecorder writes every frame sent and received to w as a capture, see
+// CaptureWriter. Replay feeds a capture back.
+func WithRecorder(w io.Writer) Option {
+	return func(dc *DanikorTCPConnection) {
+		dc.recorder = NewCaptureWriter(w)
+	}
+}
@@ -0,0 +1,117 @@
+package danikor
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Param is one key=value entry of a frame's data section.
+type Param struct {
+	Key   string
+	Value string
+}
+
+// Params keeps the entries of a data section in wire order.
+type Params []Param
+
+// String encodes the params as the controller expects them, "k1=v1;k2=v2;".
+// A param with an empty value is encoded as "k;".
+func (ps Params) String() string {
+	var sb strings.Builder
+	for _, p := range ps {
+		sb.WriteString(p.Key)
+		if p.Value != "" {
+			sb.WriteByte('=')
+			sb.WriteString(p.Value)
+		}
+		sb.WriteByte(';')
+	}
+	return sb.String()
+}
+
+// parseParams splits a "k1=v1;k2=v2;" data section. Entries without '=' are
+// kept with an empty value.
+func parseParams(str string) Params {
+	var ps Params
+	for _, part := range strings.Split(str, ";") {
+		if part == "" {
+			continue
+		}
+		key, value, _ := strings.Cut(part, "=")
+		ps = append(ps, Param{Key: key, Value: value})
+	}
+	return ps
+}
+
+// Get returns the value of the first entry with the given key.
+func (ps Params) Get(key string) (string, bool) {
+	for _, p := range ps {
+		if p.Key == key {
+			return p.Value, true
+		}
+	}
+	return "", false
+}
+
+func (ps Params) lookup(key string) (string, error) {
+	value, ok := ps.Get(key)
+	if !ok {
+		return "", fmt.Errorf("%w: %s", ErrMissingParam, key)
+	}
+	return value, nil
+}
+
+// Float returns the value of key as a number.
+func (ps Params) Float(key string) (float64, error) {
+	value, err := ps.lookup(key)
+	if err != nil {
+		return 0, err
+	}
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %s=%q", ErrBadValue, key, value)
+	}
+	return f, nil
+}
+
+// Floats returns the value of key as a comma separated list of numbers.
+func (ps Params) Floats(key string) ([]float64, error) {
+	value, err := ps.lookup(key)
+	if err != nil {
+		return nil, err
+	}
+	floats, err := parseFloats(value)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s=%q", ErrBadValue, key, value)
+	}
+	return floats, nil
+}
+
+// Int returns the value of key as an integer.
+func (ps Params) Int(key string) (int, error) {
+	value, err := ps.lookup(key)
+	if err != nil {
+		return 0, err
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %s=%q", ErrBadValue, key, value)
+	}
+	return n, nil
+}
+
+// Bool returns the value of key as a flag, "1" or "0".
+func (ps Params) Bool(key string) (bool, error) {
+	value, err := ps.lookup(key)
+	if err != nil {
+		return false, err
+	}
+	switch value {
+	case "1":
+		return true, nil
+	case "0":
+		return false, nil
+	}
+	return false, fmt.Errorf("%w: %s=%q", ErrBadValue, key, value)
+}
@@ -0,0 +1,40 @@
+package danikor
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestAnsDataParams(t *testing.T) {
+	// a curve fragment with a key this library does not know about
+	a := mustParse(t, "020000001f5430323033303130313d352c303b303930393d312e32353b303230313d313b03")
+	want := Params{{"0101", "5,0"}, {"0909", "1.25"}, {"0201", "1"}}
+	if !reflect.DeepEqual(a.Params, want) {
+		t.Fatalf("got %+v, want %+v", a.Params, want)
+	}
+
+	if f, err := a.Params.Float("0909"); err != nil || f != 1.25 {
+		t.Errorf("Float: %v %v", f, err)
+	}
+	if fs, err := a.Params.Floats("0101"); err != nil || !reflect.DeepEqual(fs, []float64{5, 0}) {
+		t.Errorf("Floats: %v %v", fs, err)
+	}
+	if b, err := a.Params.Bool("0201"); err != nil || !b {
+		t.Errorf("Bool: %v %v", b, err)
+	}
+	if _, err := a.Params.Int("0101"); !errors.Is(err, ErrBadValue) {
+		t.Errorf("Int of a list: got %v, want ErrBadValue", err)
+	}
+	if _, err := a.Params.Float("9999"); !errors.Is(err, ErrMissingParam) {
+		t.Errorf("missing key: got %v, want ErrMissingParam", err)
+	}
+
+	result := mustParse(t, testResultFrame)
+	if n, err := result.Params.Int("00011"); err != nil || n != 2 {
+		t.Errorf("0202 params: %v %v", n, err)
+	}
+	if ack := mustParse(t, "0200000008413030303141434b03"); !reflect.DeepEqual(ack.Params, Params{{"ACK", ""}}) {
+		t.Errorf("ack params: %+v", ack.Params)
+	}
+}
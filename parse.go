@@ -2,7 +2,9 @@ package danikor
 
 import (
 	"encoding/binary"
+	"errors"
 	"fmt"
+	"sort"
 	"strconv"
 	"strings"
 )
@@ -14,30 +16,84 @@ type AnsData struct {
 	AnsMode      byte
 	MID          string
 	Data         []byte
+	Params       Params // every key=value of Data in wire order, for all MIDs
 	Torque       DanitorTorque
 	TorqueResult *DanitorTorqueResult
 	Tailer       byte
 }
 
+// Frame modes seen in the AnsMode byte
+const (
+	ModeRead     byte = 'R' // host reads a parameter
+	ModeWrite    byte = 'W' // host writes a parameter
+	ModeAck      byte = 'A' // controller answers a R or W request
+	ModeTransmit byte = 'T' // controller pushes subscribed data
+)
+
+// minFrameLen is header, DataLen, mode, MID and tailer with no data.
+const minFrameLen = 1 + 4 + 1 + 4 + 1
+
 // UnmarshalBinary implements the encoding.BinaryUnmarshaler interface
 func (a *AnsData) UnmarshalBinary(data []byte) error {
+	if len(data) < minFrameLen {
+		return fmt.Errorf("%w: %d bytes", ErrTruncated, len(data))
+	}
+	if data[0] != frameHeader {
+		return fmt.Errorf("%w: 0x%02x", ErrBadHeader, data[0])
+	}
+	if data[len(data)-1] != frameTailer {
+		return fmt.Errorf("%w: 0x%02x", ErrBadTailer, data[len(data)-1])
+	}
+	if dataLen := binary.BigEndian.Uint32(data[1:5]); int64(dataLen) != int64(len(data)-6) {
+		return fmt.Errorf("%w: declared %d, got %d", ErrLengthMismatch, dataLen, len(data)-6)
+	}
+	switch data[5] {
+	case ModeRead, ModeWrite, ModeAck, ModeTransmit:
+	default:
+		return fmt.Errorf("%w: 0x%02x", ErrBadMode, data[5])
+	}
+	if !validMID(string(data[6:10])) {
+		return fmt.Errorf("%w: %q", ErrBadMID, data[6:10])
+	}
+
 	a.Header = data[0]
 	a.DataLen = binary.BigEndian.Uint32(data[1:5])
 	a.AnsMode = data[5]
 	a.MID = string(data[6:10])
 	a.Data = data[10 : len(data)-1]
+	a.Params = parseParams(string(a.Data))
 	a.Tailer = data[len(data)-1]
 	if a.MID == "0203" {
 		a.Torque = parseTorqueData(string(a.Data))
 	}
 
 	if a.MID == "0202" {
-		a.TorqueResult = parseTorqueResult(string(a.Data))
+		var err error
+		if a.TorqueResult, err = parseTorqueResult(string(a.Data)); err != nil {
+			return err
+		}
 	}
 
 	return nil
 }
 
+// MarshalBinary implements the encoding.BinaryMarshaler interface. It
+// encodes AnsMode, MID and the raw Data; DataLen is recomputed.
+func (a *AnsData) MarshalBinary() ([]byte, error) {
+	if !validMID(a.MID) {
+		return nil, fmt.Errorf("%w: %q", ErrBadMID, a.MID)
+	}
+	body := len(a.Data) + 5
+	data := make([]byte, 0, body+6)
+	data = append(data, frameHeader)
+	data = binary.BigEndian.AppendUint32(data, uint32(body))
+	data = append(data, a.AnsMode)
+	data = append(data, a.MID...)
+	data = append(data, a.Data...)
+	data = append(data, frameTailer)
+	return data, nil
+}
+
 type DanitorTorque struct {
 	SampleFrequency string    // 0101
 	Pset            string    // 0102
@@ -49,8 +105,6 @@ type DanitorTorque struct {
 }
 
 func parseTorqueData(str string) DanitorTorque {
-	fmt.Println("coming str:", str)
-
 	data := DanitorTorque{}
 	parts := strings.Split(str, ";")
 	for _, part := range parts {
@@ -106,14 +160,23 @@ func parseTorqueData(str string) DanitorTorque {
 }
 
 type DanitorTorqueResult struct {
-	FinalTorqueValue  string
-	FinalAngleMonitor string
-	FinalTime         string
-	FinalAngleFinal   string
-	FinalStatus       string
-	NgCode            string
-	StageResults      map[string]StageResult
-	Status            map[string]string
+	FinalTorqueValue  float64
+	FinalAngleMonitor float64
+	FinalTime         float64
+	FinalAngleFinal   float64
+	FinalStatus       FinalStatus
+	NgCode            NgCode
+	Stages            []Stage // ordered by Index
+
+	localizer Localizer // set by the connection, see WithLocalizer
+}
+
+// localize returns the localizer of the connection the result came from.
+func (dr *DanitorTorqueResult) localize() Localizer {
+	if dr.localizer != nil {
+		return dr.localizer
+	}
+	return defaultLocalizer
 }
 
 /*
@@ -122,53 +185,22 @@ type DanitorTorqueResult struct {
 2=NG，拧紧不合格；
 */
 func (dr *DanitorTorqueResult) ShowFinalStatus() string {
-	switch dr.FinalStatus {
-	case "0":
-		return "无定意"
-	case "1":
-		return "OK，拧紧合格"
-	case "2":
-		return "NG，拧紧不合格"
-	default:
-		return "未知状态"
-	}
+	return dr.localize().FinalStatus(dr.FinalStatus)
 }
 
 /*
 0x00=无定意；
 0x01=最终扭矩过大；
-0x02=最终扭矩过大；
+0x02=最终扭矩过小；
 0x03=最终角度过大；
 0x04=最终角度过小；
 0xn1=第 n 步扭矩过大；
-0xn2=第 n 步扭矩过大；
+0xn2=第 n 步扭矩过小；
 1<n<5
 0x90=总时间超限；
 */
 func (dr *DanitorTorqueResult) ShowNgCode() string {
-	r := ""
-	switch dr.NgCode {
-	case "00":
-		r = "无定意"
-	case "01":
-		r = "最终扭矩过大"
-	case "02":
-		r = "最终扭矩过大"
-	case "03":
-		r = "最终角度过大"
-	case "04":
-		r = "最终角度过小"
-	case "90":
-		r = "总时间超限"
-	default:
-		if strings.HasSuffix(dr.NgCode, "1") {
-			r = fmt.Sprintf("第 %s 步扭矩过大", string(dr.NgCode[0]))
-		}
-		if strings.HasSuffix(dr.NgCode, "2") {
-			r = fmt.Sprintf("第 %s 步扭矩过大", string(dr.NgCode[0]))
-		}
-	}
-	return r
+	return dr.localize().NgReason(dr.NgCode.Reason())
 }
 
 /*
@@ -181,41 +213,43 @@ func (dr *DanitorTorqueResult) ShowNgCode() string {
 6=时间过长；
 7=时间过短；
 */
-func (dr *DanitorTorqueResult) ShowStageStatus(code string) string {
-	r := ""
-	switch code {
-	case "0":
-		r = "无定意"
-	case "1":
-		r = "OK"
-	case "2":
-		r = "扭矩过大"
-	case "3":
-		r = "扭矩过小"
-	case "4":
-		r = "角度过大"
-	case "5":
-		r = "角度过小"
-	case "6":
-		r = "时间过长"
-	case "7":
-		r = "时间过短"
-	}
-	return r
+func (dr *DanitorTorqueResult) ShowStageStatus(status StageStatus) string {
+	return dr.localize().StageStatus(status)
 }
 
-type StageResult struct {
+// Stage is the outcome of one stage of the tightening program.
+type Stage struct {
+	Index  int // 1 based stage number
 	Torque float64
 	Angle  float64
 	Time   float64
-	Status string
+	Status StageStatus
 }
 
-func parseTorqueResult(str string) *DanitorTorqueResult {
-	result := &DanitorTorqueResult{
-		StageResults: make(map[string]StageResult),
-		Status:       make(map[string]string),
+// stageKey splits a 01n0 or 01n1 key into the stage number n and the last
+// digit, which tells values from status.
+func stageKey(key string) (index int, field byte, ok bool) {
+	if len(key) < 4 || key[:2] != "01" {
+		return 0, 0, false
+	}
+	index, err := strconv.Atoi(key[2 : len(key)-1])
+	if err != nil || index < 1 {
+		return 0, 0, false
+	}
+	field = key[len(key)-1]
+	if field != '0' && field != '1' {
+		return 0, 0, false
 	}
+	return index, field, true
+}
+
+// parseTorqueResult decodes a 0202 data section. Values that do not parse
+// are reported with an error wrapping ErrBadValue; the result holds every
+// field that did parse.
+func parseTorqueResult(str string) (*DanitorTorqueResult, error) {
+	var errs []error
+	result := &DanitorTorqueResult{}
+	stages := make(map[int]*Stage)
 
 	pairs := strings.Split(str, ";")
 	for _, pair := range pairs {
@@ -225,57 +259,85 @@ func parseTorqueResult(str string) *DanitorTorqueResult {
 			value := values[1]
 			switch key {
 			case "00010":
-				fields := strings.Split(value, ",")
-				if len(fields) >= 4 {
-					result.FinalTorqueValue = fields[0]
-					result.FinalAngleMonitor = fields[1]
-					result.FinalTime = fields[2]
-					result.FinalAngleFinal = fields[3]
+				fields, err := parseFloats(value)
+				if err == nil && len(fields) < 4 {
+					err = fmt.Errorf("%w: final values %q", ErrBadValue, value)
+				}
+				if err != nil {
+					errs = append(errs, err)
+					continue
 				}
+				result.FinalTorqueValue = fields[0]
+				result.FinalAngleMonitor = fields[1]
+				result.FinalTime = fields[2]
+				result.FinalAngleFinal = fields[3]
 			case "00011":
-				result.FinalStatus = value
+				status, err := parseFinalStatus(value)
+				if err != nil {
+					errs = append(errs, err)
+				}
+				result.FinalStatus = status
 			case "00012":
-				result.NgCode = value
+				code, err := parseNgCode(value)
+				if err != nil {
+					errs = append(errs, err)
+				}
+				result.NgCode = code
 			default:
-				fmt.Println("key:", key, "value:", value)
-				//key: 01030 3 is stageKey value: 0.013,1257.069,3.000(Torque,Angle,Time),
-				if len(key) >= 5 && key[:3] == "010" && strings.HasSuffix(key, "0") { //value
-					stageKey := key[3:4]
-					fmt.Println("stage:", stageKey)
-					//split value to get Torque,Angle,Time
-					values := strings.Split(value[5:], ",")
-					if len(values) == 3 {
-						torque, err := strconv.ParseFloat(values[0], 64)
-						if err != nil {
-							// handle error
-						}
-						angle, err := strconv.ParseFloat(values[1], 64)
-						if err != nil {
-							// handle error
-						}
-						time, err := strconv.ParseFloat(values[2], 64)
-						if err != nil {
-							// handle error
-						}
-						stageResult := StageResult{
-							Torque: torque,
-							Angle:  angle,
-							Time:   time,
-						}
-						result.StageResults[stageKey] = stageResult
+				// 01n0=torque,angle,time of stage n, 01n1=its status,
+				// n is one or more digits, e.g. 01050 and 01051 for stage 5
+				index, field, ok := stageKey(key)
+				if !ok {
+					continue
+				}
+				if stages[index] == nil {
+					stages[index] = &Stage{Index: index}
+				}
+				stage := stages[index]
+				switch field {
+				case '0':
+					fields, err := parseFloats(value)
+					if err == nil && len(fields) != 3 {
+						err = fmt.Errorf("%w: stage %d values %q", ErrBadValue, index, value)
+					}
+					if err != nil {
+						errs = append(errs, err)
+						continue
+					}
+					stage.Torque = fields[0]
+					stage.Angle = fields[1]
+					stage.Time = fields[2]
+				case '1':
+					status, err := parseStageStatus(value)
+					if err != nil {
+						errs = append(errs, err)
 					}
+					stage.Status = status
 				}
+			}
+		}
+	}
 
-				if len(key) >= 5 && key[:3] == "010" && strings.HasSuffix(key, "1") {
-					stageKey := key[3:4]
-					fmt.Println("status stage:", stageKey)
-					result.Status[stageKey] = value
+	for _, stage := range stages {
+		result.Stages = append(result.Stages, *stage)
+	}
+	sort.Slice(result.Stages, func(i, j int) bool {
+		return result.Stages[i].Index < result.Stages[j].Index
+	})
 
-				}
+	return result, errors.Join(errs...)
+}
 
-			}
+// parseFloats splits a comma separated list of numbers.
+func parseFloats(value string) ([]float64, error) {
+	fields := strings.Split(value, ",")
+	floats := make([]float64, len(fields))
+	for i, f := range fields {
+		v, err := strconv.ParseFloat(f, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %q", ErrBadValue, value)
 		}
+		floats[i] = v
 	}
-
-	return result
+	return floats, nil
 }
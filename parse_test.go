@@ -0,0 +1,178 @@
+package danikor
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestAnsDataUnmarshalBinaryErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		frame string
+		want  error
+	}{
+		{"empty", "", ErrTruncated},
+		{"short", "0200000008413030", ErrTruncated},
+		{"header", "0300000008413030303141434b03", ErrBadHeader},
+		{"tailer", "0200000008413030303141434b02", ErrBadTailer},
+		{"length", "0200000009413030303141434b03", ErrLengthMismatch},
+		{"mode", "0200000008583030303141434b03", ErrBadMode},
+		{"mid", "02000000084130303f3141434b03", ErrBadMID},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var a AnsData
+			err := a.UnmarshalBinary(mustHex(t, tt.frame))
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("got %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseDataProtocolError(t *testing.T) {
+	_, err := parseData(mustHex(t, "0200000009413030303141434b03"))
+	var perr *ProtocolError
+	if !errors.As(err, &perr) || !errors.Is(err, ErrLengthMismatch) {
+		t.Fatalf("got %v, want *ProtocolError wrapping ErrLengthMismatch", err)
+	}
+
+	a, err := parseData(mustHex(t, "0200000008413030303141434b03"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.AnsMode != ModeAck || a.MID != "0001" || string(a.Data) != "ACK" {
+		t.Fatalf("unexpected ack %+v", a)
+	}
+}
+
+func TestParseTorqueResultTyped(t *testing.T) {
+	a, err := parseData(mustHex(t, testResultFrame))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := a.TorqueResult
+	if r.FinalTorqueValue != 0.012 || r.FinalAngleMonitor != 0 || r.FinalTime != 3 || r.FinalAngleFinal != 1257.069 {
+		t.Errorf("unexpected final values %+v", r)
+	}
+	if !r.FinalStatus.NG() || r.FinalStatus.OK() {
+		t.Errorf("final status %v, want NG", r.FinalStatus)
+	}
+	if r.NgCode != 0x52 || r.NgCode.Reason() != (NgReason{Kind: NgTorqueLow, Stage: 5}) {
+		t.Errorf("ng code %#x decoded to %+v", r.NgCode, r.NgCode.Reason())
+	}
+
+	r, err = parseTorqueResult("00010=0.012,x,3.000,1257.069;00011=1;00012=zz;")
+	if !errors.Is(err, ErrBadValue) {
+		t.Fatalf("got %v, want ErrBadValue", err)
+	}
+	if !r.FinalStatus.OK() {
+		t.Errorf("fields that parse are kept, got status %v", r.FinalStatus)
+	}
+}
+
+func TestNgCodeReason(t *testing.T) {
+	tests := []struct {
+		code NgCode
+		want NgReason
+	}{
+		{0x00, NgReason{Kind: NgNone}},
+		{0x01, NgReason{Kind: NgTorqueHigh}},
+		{0x02, NgReason{Kind: NgTorqueLow}},
+		{0x03, NgReason{Kind: NgAngleHigh}},
+		{0x04, NgReason{Kind: NgAngleLow}},
+		{0x21, NgReason{Kind: NgTorqueHigh, Stage: 2}},
+		{0x32, NgReason{Kind: NgTorqueLow, Stage: 3}},
+		{0x90, NgReason{Kind: NgOvertime}},
+		{0x05, NgReason{Kind: NgUnknown}},
+	}
+	for _, tt := range tests {
+		if got := tt.code.Reason(); got != tt.want {
+			t.Errorf("%#x: got %+v, want %+v", tt.code, got, tt.want)
+		}
+	}
+}
+
+func TestParseTorqueResultStages(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want []Stage
+	}{
+		{
+			// captured from a controller, NG in stage 5
+			name: "captured r_1",
+			data: string(mustParse(t, testResultFrame).Data),
+			want: []Stage{
+				{Index: 1, Status: StageOK},
+				{Index: 2, Status: StageOK},
+				{Index: 3, Status: StageOK},
+				{Index: 4, Status: StageOK},
+				{Index: 5, Torque: 0.012, Angle: 1257.069, Time: 3, Status: StageTimeLong},
+			},
+		},
+		{
+			name: "two digit stages",
+			data: "00011=1;01090=1.500,90.000,0.500;01091=1;01100=2.250,180.000,1.250;01101=1;01120=3.000,10.000,0.100;01121=3;",
+			want: []Stage{
+				{Index: 9, Torque: 1.5, Angle: 90, Time: 0.5, Status: StageOK},
+				{Index: 10, Torque: 2.25, Angle: 180, Time: 1.25, Status: StageOK},
+				{Index: 12, Torque: 3, Angle: 10, Time: 0.1, Status: StageTorqueLow},
+			},
+		},
+		{
+			name: "status before values",
+			data: "01021=4;01020=0.100,200.000,0.300;",
+			want: []Stage{
+				{Index: 2, Torque: 0.1, Angle: 200, Time: 0.3, Status: StageAngleHigh},
+			},
+		},
+		{
+			name: "no stages",
+			data: "00010=0.012,0.000,3.000,1257.069;00011=2;00012=90;",
+			want: nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := parseTorqueResult(tt.data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(r.Stages, tt.want) {
+				t.Fatalf("got %+v, want %+v", r.Stages, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseTorqueResultStageErrors(t *testing.T) {
+	for _, data := range []string{
+		"01010=0.000,0.000;01011=1;",
+		"01010=0.000,abc,0.000;",
+		"01011=x;",
+	} {
+		if _, err := parseTorqueResult(data); !errors.Is(err, ErrBadValue) {
+			t.Errorf("%q: got %v, want ErrBadValue", data, err)
+		}
+	}
+}
+
+func TestAnsDataMarshalBinary(t *testing.T) {
+	for _, hexStr := range []string{testCurveFrame, testResultFrame, "0200000008413030303141434b03"} {
+		frame := mustHex(t, hexStr)
+		var a AnsData
+		if err := a.UnmarshalBinary(frame); err != nil {
+			t.Fatal(err)
+		}
+		got, err := a.MarshalBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, frame) {
+			t.Fatalf("got %x, want %x", got, frame)
+		}
+	}
+}
@@ -0,0 +1,260 @@
+package danikor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+)
+
+// DefaultProxyWritable are the MIDs a proxy master may write unless
+// WithWritable says otherwise: pset selection.
+var DefaultProxyWritable = []string{"0103"}
+
+// proxyClientBuffer is how many frames may queue for a downstream client
+// before it is considered too slow and dropped.
+const proxyClientBuffer = 256
+
+// Proxy shares one controller session among many clients speaking the
+// controller protocol, e.g. an HMI, an MES uploader and a laptop. Clients
+// get the establish and subscriptions answered by the proxy, the 0202 and
+// 0203 pushes they subscribed to, and the answers of reads, which are
+// forwarded upstream. Everything else is refused with a NAK, except writes
+// of the writable MIDs sent by the master client.
+//
+// The proxy subscribes the upstream connection to results and curves once
+// it is up; with Run the subscriptions survive reconnects.
+type Proxy struct {
+	dc       *DanikorTCPConnection
+	master   string // host of the master client
+	writable map[string]bool
+
+	mu       sync.Mutex
+	listener net.Listener
+	clients  map[*proxyClient]bool
+	closed   bool
+}
+
+// ProxyOption configures a Proxy.
+type ProxyOption func(*Proxy)
+
+// WithMaster makes the client connecting from host, e.g. "10.0.0.7", the
+// master: the only one whose writes reach the controller. Without a master
+// the proxy is read only.
+func WithMaster(host string) ProxyOption {
+	return func(p *Proxy) {
+		p.master = host
+	}
+}
+
+// WithWritable sets the MIDs the master may write, DefaultProxyWritable by
+// default.
+func WithWritable(mids ...string) ProxyOption {
+	return func(p *Proxy) {
+		p.writable = make(map[string]bool)
+		for _, mid := range mids {
+			p.writable[mid] = true
+		}
+	}
+}
+
+// NewProxy returns a proxy in front of the controller behind dc. Dial dc or
+// keep it up with Run, then call Serve.
+func NewProxy(dc *DanikorTCPConnection, opts ...ProxyOption) *Proxy {
+	p := &Proxy{dc: dc, clients: make(map[*proxyClient]bool)}
+	WithWritable(DefaultProxyWritable...)(p)
+	for _, opt := range opts {
+		opt(p)
+	}
+	return p
+}
+
+// Subscribe subscribes the upstream connection to results and curves. Call
+// it once dc is connected, e.g. from the state callback on StateConnected.
+func (p *Proxy) Subscribe(ctx context.Context) error {
+	if _, err := p.dc.SubscribeRealTimeData(ctx); err != nil {
+		return err
+	}
+	_, err := p.dc.SubscribeResultData(ctx)
+	return err
+}
+
+// Serve accepts clients on l until Close and fans the pushes of the
+// controller out to them.
+func (p *Proxy) Serve(l net.Listener) error {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return ErrClosed
+	}
+	p.listener = l
+	p.mu.Unlock()
+
+	// one subscription keeps curves and results in the order they arrived;
+	// it blocks rather than drop a fragment, slow clients are dropped instead
+	events, cancel := p.dc.Events("", WithBuffer(proxyClientBuffer), WithPolicy(Block))
+	defer cancel()
+	go p.fanOut(events)
+
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			p.mu.Lock()
+			closed := p.closed
+			p.mu.Unlock()
+			if closed {
+				return ErrClosed
+			}
+			return err
+		}
+		c := &proxyClient{
+			proxy:      p,
+			conn:       conn,
+			out:        make(chan []byte, proxyClientBuffer),
+			subscribed: make(map[string]bool),
+		}
+		host, _, _ := net.SplitHostPort(conn.RemoteAddr().String())
+		c.master = p.master != "" && host == p.master
+		p.mu.Lock()
+		p.clients[c] = true
+		p.mu.Unlock()
+		p.dc.logger.Info("danikor: proxy client connected", "addr", conn.RemoteAddr().String(), "master", c.master)
+		go c.writeLoop()
+		go c.readLoop()
+	}
+}
+
+// Close stops accepting and disconnects every client. The upstream
+// connection stays open.
+func (p *Proxy) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.closed = true
+	for c := range p.clients {
+		c.conn.Close()
+	}
+	if p.listener != nil {
+		return p.listener.Close()
+	}
+	return nil
+}
+
+func (p *Proxy) fanOut(events <-chan AnsData) {
+	for ansData := range events {
+		if ansData.AnsMode != ModeTransmit {
+			continue
+		}
+		frame, err := ansData.MarshalBinary()
+		if err != nil {
+			continue
+		}
+		p.mu.Lock()
+		for c := range p.clients {
+			if c.wants(ansData.MID) {
+				c.send(frame)
+			}
+		}
+		p.mu.Unlock()
+	}
+}
+
+func (p *Proxy) remove(c *proxyClient) {
+	p.mu.Lock()
+	if p.clients[c] {
+		delete(p.clients, c)
+		close(c.out)
+	}
+	p.mu.Unlock()
+	c.conn.Close()
+}
+
+// proxyClient is one downstream connection.
+type proxyClient struct {
+	proxy  *Proxy
+	conn   net.Conn
+	master bool
+	out    chan []byte // closed by Proxy.remove under Proxy.mu
+
+	mu         sync.Mutex
+	subscribed map[string]bool
+}
+
+func (c *proxyClient) wants(mid string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.subscribed[mid]
+}
+
+// send queues frame, dropping a client that does not keep up. Proxy.mu is
+// held.
+func (c *proxyClient) send(frame []byte) {
+	select {
+	case c.out <- frame:
+	default:
+		c.proxy.dc.logger.Warn("danikor: proxy client too slow, dropped", "addr", c.conn.RemoteAddr().String())
+		c.conn.Close()
+	}
+}
+
+func (c *proxyClient) writeLoop() {
+	for frame := range c.out {
+		if _, err := c.conn.Write(frame); err != nil {
+			c.conn.Close()
+		}
+	}
+}
+
+func (c *proxyClient) readLoop() {
+	defer c.proxy.remove(c)
+	reader := NewFrameReader(c.conn)
+	for {
+		frame, err := reader.ReadFrame()
+		if err != nil {
+			return
+		}
+		var req Request
+		if err := req.UnmarshalBinary(frame); err != nil {
+			continue
+		}
+		ack := c.answer(&req)
+		data, err := ack.MarshalBinary()
+		if err != nil {
+			continue
+		}
+		c.proxy.mu.Lock()
+		if c.proxy.clients[c] {
+			c.send(data)
+		}
+		c.proxy.mu.Unlock()
+	}
+}
+
+// answer handles one request of the client and returns the ack to send.
+func (c *proxyClient) answer(req *Request) AnsData {
+	ack := AnsData{AnsMode: ModeAck, MID: req.MID, Data: []byte("ACK")}
+	nak := AnsData{AnsMode: ModeAck, MID: req.MID, Data: []byte("NAK")}
+	switch {
+	case req.Mode == ModeRead && req.MID == "0001":
+		return ack
+	case req.Mode == ModeRead && (req.MID == "0202" || req.MID == "0203"):
+		c.mu.Lock()
+		c.subscribed[req.MID] = true
+		c.mu.Unlock()
+		return ack
+	case req.Mode == ModeRead:
+	case req.Mode == ModeWrite && c.master && c.proxy.writable[req.MID]:
+	default:
+		// only reads and the master's writable MIDs go upstream, acks and
+		// pushes sent by a client never do
+		c.proxy.dc.logger.Warn("danikor: proxy refused request", "addr", c.conn.RemoteAddr().String(), "request", req.String())
+		return nak
+	}
+
+	answer, err := c.proxy.dc.Do(context.Background(), req)
+	if err != nil && !errors.Is(err, ErrNak) {
+		c.proxy.dc.reportError(fmt.Errorf("danikor: proxy: %w", err))
+		return nak
+	}
+	return answer
+}
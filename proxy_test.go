@@ -0,0 +1,129 @@
+package danikor_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/linexjlin/danikor"
+	"github.com/linexjlin/danikor/danikortest"
+)
+
+func startProxy(t *testing.T, s *danikortest.Server, opts ...danikor.ProxyOption) string {
+	t.Helper()
+	upstream := danikor.NewDanikorTCPConnection(s.Addr(), nil)
+	if err := upstream.DialContext(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { upstream.Close() })
+	p := danikor.NewProxy(upstream, opts...)
+	if err := p.Subscribe(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go p.Serve(l)
+	t.Cleanup(func() { p.Close() })
+	return l.Addr().String()
+}
+
+func dialProxy(t *testing.T, addr string) *danikor.DanikorTCPConnection {
+	t.Helper()
+	dc := danikor.NewDanikorTCPConnection(addr, nil)
+	if err := dc.DialContext(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { dc.Close() })
+	return dc
+}
+
+func TestProxyFanOut(t *testing.T) {
+	s := danikortest.NewServer()
+	defer s.Close()
+	addr := startProxy(t, s)
+	ctx := context.Background()
+
+	var cycles []<-chan *danikor.TighteningCycle
+	for i := 0; i < 3; i++ {
+		dc := dialProxy(t, addr)
+		ch, cancel := dc.Cycles()
+		defer cancel()
+		cycles = append(cycles, ch)
+		if _, err := dc.Establish(ctx); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := dc.SubscribeRealTimeData(ctx); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := dc.SubscribeResultData(ctx); err != nil {
+			t.Fatal(err)
+		}
+		// reads reach the controller
+		if _, err := dc.GetPset(ctx, 1); err != nil {
+			t.Fatal(err)
+		}
+		// writes do not without a master
+		if _, err := dc.ChosePset(ctx, 2); !errors.Is(err, danikor.ErrNak) {
+			t.Fatalf("client %d chose a pset through a read only proxy: %v", i, err)
+		}
+	}
+
+	s.Tighten()
+	for i, ch := range cycles {
+		select {
+		case c := <-ch:
+			if c.Curve == nil || len(c.Curve.Torque) != 100 || c.Result == nil {
+				t.Fatalf("client %d got cycle %+v", i, c)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("client %d got no cycle", i)
+		}
+	}
+	for _, req := range s.Requests() {
+		if req.Mode == danikor.ModeWrite {
+			t.Fatalf("write %s reached the controller", req.String())
+		}
+	}
+}
+
+func TestProxyMaster(t *testing.T) {
+	s := danikortest.NewServer()
+	defer s.Close()
+	addr := startProxy(t, s, danikor.WithMaster("127.0.0.1"))
+	dc := dialProxy(t, addr)
+	ctx := context.Background()
+
+	if _, err := dc.ChosePset(ctx, 4); err != nil {
+		t.Fatal(err)
+	}
+	if s.SelectedPset() != 4 {
+		t.Fatalf("pset %d selected, want 4", s.SelectedPset())
+	}
+	// the controller's own NAK comes back through the proxy
+	if _, err := dc.Do(ctx, danikor.NewRequest(danikor.ModeWrite, "0103", danikor.Param{Key: "01", Value: "9"})); !errors.Is(err, danikor.ErrNak) {
+		t.Fatalf("pset 9: %v", err)
+	}
+	if _, err := dc.ForwardTurn(ctx); !errors.Is(err, danikor.ErrNak) {
+		t.Fatalf("forward turn is not writable: %v", err)
+	}
+
+	// acks and pushes from a client never reach the controller, not even
+	// from the master or on a writable MID
+	for _, mode := range []byte{danikor.ModeTransmit, danikor.ModeAck} {
+		for _, mid := range []string{"0301", "0103"} {
+			req := danikor.NewRequest(mode, mid, danikor.Param{Key: "01", Value: "1"})
+			if _, err := dc.Do(ctx, req); !errors.Is(err, danikor.ErrNak) {
+				t.Fatalf("%s: got %v, want ErrNak", req, err)
+			}
+		}
+	}
+	for _, req := range s.Requests() {
+		if req.Mode != danikor.ModeRead && req.Mode != danikor.ModeWrite {
+			t.Fatalf("%s reached the controller", req.String())
+		}
+	}
+}
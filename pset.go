@@ -0,0 +1,261 @@
+package danikor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+// MaxPset is the highest pset number a controller holds; psets count from 1.
+const MaxPset = 8
+
+var ErrInvalidPset = errors.New("danikor: invalid pset")
+
+func checkPset(pset int) error {
+	if pset < 1 || pset > MaxPset {
+		return fmt.Errorf("%w: pset number not support %d", ErrInvalidPset, pset)
+	}
+	return nil
+}
+
+// StageSetting is the program of one tightening stage. Stage n of a pset
+// reports its outcome as Stage n of the DanitorTorqueResult.
+type StageSetting struct {
+	Index        int     `json:"index"` // 1 based stage number
+	TargetTorque float64 `json:"target_torque"`
+	Speed        float64 `json:"speed"` // rpm
+	AngleMin     float64 `json:"angle_min"`
+	AngleMax     float64 `json:"angle_max"`
+}
+
+// Pset is a tightening program. Torques are in N·m, angles in degrees and
+// TimeLimit in seconds.
+type Pset struct {
+	TargetTorque float64        `json:"target_torque"`
+	TorqueMin    float64        `json:"torque_min"`
+	TorqueMax    float64        `json:"torque_max"`
+	AngleMin     float64        `json:"angle_min"`
+	AngleMax     float64        `json:"angle_max"`
+	Speed        float64        `json:"speed"` // rpm
+	TimeLimit    float64        `json:"time_limit"`
+	Stages       []StageSetting `json:"stages"`
+}
+
+// Validate checks the program for values the controller would reject or
+// that cannot be what was meant, before anything is sent.
+func (p Pset) Validate() error {
+	switch {
+	case p.TorqueMin < 0 || p.TorqueMin > p.TargetTorque || p.TargetTorque > p.TorqueMax:
+		return fmt.Errorf("%w: torque window %v <= %v <= %v", ErrInvalidPset, p.TorqueMin, p.TargetTorque, p.TorqueMax)
+	case p.AngleMin < 0 || p.AngleMin > p.AngleMax:
+		return fmt.Errorf("%w: angle window %v..%v", ErrInvalidPset, p.AngleMin, p.AngleMax)
+	case p.Speed <= 0:
+		return fmt.Errorf("%w: speed %v", ErrInvalidPset, p.Speed)
+	case p.TimeLimit <= 0:
+		return fmt.Errorf("%w: time limit %v", ErrInvalidPset, p.TimeLimit)
+	case len(p.Stages) > 9:
+		return fmt.Errorf("%w: %d stages, at most 9", ErrInvalidPset, len(p.Stages))
+	}
+	for i, s := range p.Stages {
+		switch {
+		case s.Index != i+1:
+			return fmt.Errorf("%w: stage %d has index %d", ErrInvalidPset, i+1, s.Index)
+		case s.TargetTorque < 0 || s.TargetTorque > p.TorqueMax:
+			return fmt.Errorf("%w: stage %d torque %v", ErrInvalidPset, s.Index, s.TargetTorque)
+		case s.Speed <= 0:
+			return fmt.Errorf("%w: stage %d speed %v", ErrInvalidPset, s.Index, s.Speed)
+		case s.AngleMin < 0 || s.AngleMin > s.AngleMax:
+			return fmt.Errorf("%w: stage %d angle window %v..%v", ErrInvalidPset, s.Index, s.AngleMin, s.AngleMax)
+		}
+	}
+	return nil
+}
+
+// PsetChange is one setting that differs between two psets.
+type PsetChange struct {
+	Field    string // e.g. "TorqueMax" or "Stages[2].Speed"
+	Old, New string
+}
+
+func (c PsetChange) String() string {
+	return fmt.Sprintf("%s: %s -> %s", c.Field, c.Old, c.New)
+}
+
+// Diff lists the settings that change when going from p to next.
+func (p Pset) Diff(next Pset) []PsetChange {
+	var changes []PsetChange
+	add := func(field string, old, new float64) {
+		if formatValue(old) != formatValue(new) {
+			changes = append(changes, PsetChange{Field: field, Old: formatValue(old), New: formatValue(new)})
+		}
+	}
+	add("TargetTorque", p.TargetTorque, next.TargetTorque)
+	add("TorqueMin", p.TorqueMin, next.TorqueMin)
+	add("TorqueMax", p.TorqueMax, next.TorqueMax)
+	add("AngleMin", p.AngleMin, next.AngleMin)
+	add("AngleMax", p.AngleMax, next.AngleMax)
+	add("Speed", p.Speed, next.Speed)
+	add("TimeLimit", p.TimeLimit, next.TimeLimit)
+
+	if len(p.Stages) != len(next.Stages) {
+		changes = append(changes, PsetChange{Field: "len(Stages)", Old: strconv.Itoa(len(p.Stages)), New: strconv.Itoa(len(next.Stages))})
+	}
+	for i := 0; i < len(p.Stages) && i < len(next.Stages); i++ {
+		old, new := p.Stages[i], next.Stages[i]
+		prefix := fmt.Sprintf("Stages[%d].", i+1)
+		add(prefix+"TargetTorque", old.TargetTorque, new.TargetTorque)
+		add(prefix+"Speed", old.Speed, new.Speed)
+		add(prefix+"AngleMin", old.AngleMin, new.AngleMin)
+		add(prefix+"AngleMax", old.AngleMax, new.AngleMax)
+	}
+	return changes
+}
+
+// formatValue writes a setting the way the controller sends numbers.
+func formatValue(v float64) string {
+	return strconv.FormatFloat(v, 'f', 3, 64)
+}
+
+// PsetLayout says where the settings of a pset live in the controller's
+// parameter table: the MID holding a pset or one of its stages, and the key
+// of each setting within it.
+type PsetLayout struct {
+	MID      func(pset int) string
+	StageMID func(pset, stage int) string
+
+	TargetTorque, TorqueMin, TorqueMax string
+	AngleMin, AngleMax                 string
+	Speed, TimeLimit, StageCount       string
+
+	StageTargetTorque, StageSpeed string
+	StageAngleMin, StageAngleMax  string
+}
+
+// DefaultPsetLayout keeps pset n at MID 11nn and its stage k at MID 12nk.
+// Check it against the parameter table of your controller's firmware and
+// pass a different layout with WithPsetLayout if it differs.
+var DefaultPsetLayout = PsetLayout{
+	MID:      func(pset int) string { return fmt.Sprintf("11%02d", pset) },
+	StageMID: func(pset, stage int) string { return fmt.Sprintf("12%d%d", pset, stage) },
+
+	TargetTorque: "01",
+	TorqueMin:    "02",
+	TorqueMax:    "03",
+	AngleMin:     "04",
+	AngleMax:     "05",
+	Speed:        "06",
+	TimeLimit:    "07",
+	StageCount:   "08",
+
+	StageTargetTorque: "01",
+	StageSpeed:        "02",
+	StageAngleMin:     "03",
+	StageAngleMax:     "04",
+}
+
+// GetPset reads program pset from the controller.
+func (dc *DanikorTCPConnection) GetPset(ctx context.Context, pset int) (Pset, error) {
+	if err := checkPset(pset); err != nil {
+		return Pset{}, err
+	}
+	l := dc.psetLayout
+	params, err := dc.ReadParams(ctx, l.MID(pset), l.TargetTorque, l.TorqueMin, l.TorqueMax, l.AngleMin, l.AngleMax, l.Speed, l.TimeLimit, l.StageCount)
+	if err != nil {
+		return Pset{}, err
+	}
+
+	v, err := floatParams(params, l.TargetTorque, l.TorqueMin, l.TorqueMax, l.AngleMin, l.AngleMax, l.Speed, l.TimeLimit)
+	if err != nil {
+		return Pset{}, fmt.Errorf("pset %d: %w", pset, err)
+	}
+	p := Pset{
+		TargetTorque: v[0],
+		TorqueMin:    v[1],
+		TorqueMax:    v[2],
+		AngleMin:     v[3],
+		AngleMax:     v[4],
+		Speed:        v[5],
+		TimeLimit:    v[6],
+	}
+	stages, err := params.Int(l.StageCount)
+	if err != nil {
+		return Pset{}, fmt.Errorf("pset %d: %w", pset, err)
+	}
+
+	for i := 1; i <= stages; i++ {
+		keys := []string{l.StageTargetTorque, l.StageSpeed, l.StageAngleMin, l.StageAngleMax}
+		params, err := dc.ReadParams(ctx, l.StageMID(pset, i), keys...)
+		if err != nil {
+			return Pset{}, err
+		}
+		v, err := floatParams(params, keys...)
+		if err != nil {
+			return Pset{}, fmt.Errorf("pset %d stage %d: %w", pset, i, err)
+		}
+		p.Stages = append(p.Stages, StageSetting{Index: i, TargetTorque: v[0], Speed: v[1], AngleMin: v[2], AngleMax: v[3]})
+	}
+	return p, nil
+}
+
+func floatParams(params Params, keys ...string) ([]float64, error) {
+	values := make([]float64, len(keys))
+	for i, key := range keys {
+		v, err := params.Float(key)
+		if err != nil {
+			return nil, err
+		}
+		values[i] = v
+	}
+	return values, nil
+}
+
+// SetPset validates p, compares it with program pset on the controller and
+// writes the settings that differ. It returns what changed; nothing is
+// written when the list is empty.
+func (dc *DanikorTCPConnection) SetPset(ctx context.Context, pset int, p Pset) ([]PsetChange, error) {
+	if err := checkPset(pset); err != nil {
+		return nil, err
+	}
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+	current, err := dc.GetPset(ctx, pset)
+	if err != nil {
+		return nil, err
+	}
+	changes := current.Diff(p)
+	if len(changes) == 0 {
+		return nil, nil
+	}
+
+	l := dc.psetLayout
+	for i, s := range p.Stages {
+		if i < len(current.Stages) && current.Stages[i] == s {
+			continue
+		}
+		err := dc.WriteParams(ctx, l.StageMID(pset, s.Index), map[string]string{
+			l.StageTargetTorque: formatValue(s.TargetTorque),
+			l.StageSpeed:        formatValue(s.Speed),
+			l.StageAngleMin:     formatValue(s.AngleMin),
+			l.StageAngleMax:     formatValue(s.AngleMax),
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	err = dc.WriteParams(ctx, l.MID(pset), map[string]string{
+		l.TargetTorque: formatValue(p.TargetTorque),
+		l.TorqueMin:    formatValue(p.TorqueMin),
+		l.TorqueMax:    formatValue(p.TorqueMax),
+		l.AngleMin:     formatValue(p.AngleMin),
+		l.AngleMax:     formatValue(p.AngleMax),
+		l.Speed:        formatValue(p.Speed),
+		l.TimeLimit:    formatValue(p.TimeLimit),
+		l.StageCount:   strconv.Itoa(len(p.Stages)),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return changes, nil
+}
@@ -0,0 +1,78 @@
+package danikor
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func testPsetStore() map[string]map[string]string {
+	return map[string]map[string]string{
+		"1102": {"01": "5.000", "02": "4.500", "03": "5.500", "04": "0.000", "05": "1440.000", "06": "300.000", "07": "5.000", "08": "2"},
+		"1221": {"01": "1.000", "02": "600.000", "03": "0.000", "04": "1080.000"},
+		"1222": {"01": "5.000", "02": "100.000", "03": "0.000", "04": "360.000"},
+	}
+}
+
+func TestGetSetPset(t *testing.T) {
+	store := testPsetStore()
+	dc := paramServer(t, store)
+	ctx := context.Background()
+
+	p, err := dc.GetPset(ctx, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Pset{
+		TargetTorque: 5, TorqueMin: 4.5, TorqueMax: 5.5, AngleMin: 0, AngleMax: 1440, Speed: 300, TimeLimit: 5,
+		Stages: []StageSetting{
+			{Index: 1, TargetTorque: 1, Speed: 600, AngleMin: 0, AngleMax: 1080},
+			{Index: 2, TargetTorque: 5, Speed: 100, AngleMin: 0, AngleMax: 360},
+		},
+	}
+	if !reflect.DeepEqual(p, want) {
+		t.Fatalf("got %+v, want %+v", p, want)
+	}
+
+	if changes, err := dc.SetPset(ctx, 2, p); err != nil || changes != nil {
+		t.Fatalf("unchanged pset: %v %v", changes, err)
+	}
+
+	p.TorqueMax = 6
+	p.Stages = append([]StageSetting(nil), p.Stages...)
+	p.Stages[1].Speed = 80
+	changes, err := dc.SetPset(ctx, 2, p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantChanges := []PsetChange{
+		{Field: "TorqueMax", Old: "5.500", New: "6.000"},
+		{Field: "Stages[2].Speed", Old: "100.000", New: "80.000"},
+	}
+	if !reflect.DeepEqual(changes, wantChanges) {
+		t.Fatalf("got changes %v, want %v", changes, wantChanges)
+	}
+	if store["1102"]["03"] != "6.000" || store["1222"]["02"] != "80.000" {
+		t.Fatalf("changes not written: %v", store)
+	}
+
+	// invalid programs never reach the controller
+	bad := p
+	bad.TorqueMin = 7
+	if _, err := dc.SetPset(ctx, 2, bad); !errors.Is(err, ErrInvalidPset) {
+		t.Fatalf("got %v, want ErrInvalidPset", err)
+	}
+	if store["1102"]["02"] != "4.500" {
+		t.Fatal("invalid pset was written")
+	}
+	if _, err := dc.GetPset(ctx, 9); !errors.Is(err, ErrInvalidPset) {
+		t.Fatalf("pset 9: got %v, want ErrInvalidPset", err)
+	}
+	if _, err := dc.SetPset(ctx, 9, testPset(1)); !errors.Is(err, ErrInvalidPset) {
+		t.Fatalf("pset 9: got %v, want ErrInvalidPset", err)
+	}
+	if _, err := dc.ChosePset(ctx, 0); !errors.Is(err, ErrInvalidPset) {
+		t.Fatalf("pset 0: got %v, want ErrInvalidPset", err)
+	}
+}
@@ -0,0 +1,72 @@
+package danikor
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strings"
+)
+
+// Request is a frame sent by the host to the controller.
+type Request struct {
+	Mode   byte // ModeRead or ModeWrite
+	MID    string
+	Params Params
+}
+
+func NewRequest(mode byte, mid string, params ...Param) *Request {
+	return &Request{Mode: mode, MID: mid, Params: params}
+}
+
+// MarshalBinary implements the encoding.BinaryMarshaler interface. The
+// DataLen field is computed from the encoded mode, MID and params.
+func (r *Request) MarshalBinary() ([]byte, error) {
+	switch r.Mode {
+	case ModeRead, ModeWrite, ModeAck, ModeTransmit:
+	default:
+		return nil, fmt.Errorf("%w: 0x%02x", ErrBadMode, r.Mode)
+	}
+	if !validMID(r.MID) {
+		return nil, fmt.Errorf("%w: %q", ErrBadMID, r.MID)
+	}
+	for _, p := range r.Params {
+		if p.Key == "" || strings.ContainsAny(p.Key, "=;") || strings.ContainsRune(p.Value, ';') {
+			return nil, fmt.Errorf("danikor: invalid param %q=%q", p.Key, p.Value)
+		}
+	}
+
+	body := string(r.Mode) + r.MID + r.Params.String()
+	data := make([]byte, 0, len(body)+6)
+	data = append(data, frameHeader)
+	data = binary.BigEndian.AppendUint32(data, uint32(len(body)))
+	data = append(data, body...)
+	data = append(data, frameTailer)
+	return data, nil
+}
+
+// UnmarshalBinary implements the encoding.BinaryUnmarshaler interface.
+func (r *Request) UnmarshalBinary(data []byte) error {
+	var a AnsData
+	if err := a.UnmarshalBinary(data); err != nil {
+		return err
+	}
+	r.Mode = a.AnsMode
+	r.MID = a.MID
+	r.Params = a.Params
+	return nil
+}
+
+func (r *Request) String() string {
+	return string(r.Mode) + r.MID + r.Params.String()
+}
+
+func validMID(mid string) bool {
+	if len(mid) != 4 {
+		return false
+	}
+	for _, c := range []byte(mid) {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,50 @@
+package danikor
+
+import (
+	"encoding/hex"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestRequestMarshalBinary(t *testing.T) {
+	tests := []struct {
+		req  *Request
+		want string
+	}{
+		{NewRequest(ModeRead, "0001"), "0200000005523030303103"},
+		{NewRequest(ModeRead, "0203"), "0200000005523032303303"},
+		{NewRequest(ModeWrite, "0301", Param{"01", "1"}), "020000000a573033303130313d313b03"},
+		{NewRequest(ModeWrite, "0103", Param{"01", "8"}), "020000000a573031303330313d383b03"},
+		{NewRequest(ModeWrite, "0103", Param{"01", "8"}, Param{"02", "12.5"}), "0200000012573031303330313d383b30323d31322e353b03"},
+	}
+	for _, tt := range tests {
+		data, err := tt.req.MarshalBinary()
+		if err != nil {
+			t.Fatalf("%s: %v", tt.req, err)
+		}
+		if got := hex.EncodeToString(data); got != tt.want {
+			t.Errorf("%s: got %s, want %s", tt.req, got, tt.want)
+		}
+
+		var back Request
+		if err := back.UnmarshalBinary(data); err != nil {
+			t.Fatalf("%s: %v", tt.req, err)
+		}
+		if !reflect.DeepEqual(&back, tt.req) {
+			t.Errorf("round trip: got %+v, want %+v", back, tt.req)
+		}
+	}
+}
+
+func TestRequestMarshalBinaryInvalid(t *testing.T) {
+	if _, err := NewRequest('X', "0001").MarshalBinary(); !errors.Is(err, ErrBadMode) {
+		t.Errorf("mode: got %v", err)
+	}
+	if _, err := NewRequest(ModeRead, "01").MarshalBinary(); !errors.Is(err, ErrBadMID) {
+		t.Errorf("mid: got %v", err)
+	}
+	if _, err := NewRequest(ModeWrite, "0103", Param{"01", "1;2"}).MarshalBinary(); err == nil {
+		t.Errorf("param: expected error")
+	}
+}
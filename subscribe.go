@@ -0,0 +1,158 @@
+package danikor
+
+import "sync"
+
+// DefaultSubscribeBuffer is the channel buffer of a subscription unless
+// WithBuffer says otherwise.
+const DefaultSubscribeBuffer = 16
+
+// Policy decides what happens to an event when a subscriber's buffer is full.
+type Policy int
+
+const (
+	DropNewest Policy = iota // discard the event that does not fit
+	DropOldest               // discard the oldest buffered event to make room
+	Block                    // wait for the subscriber; this stalls delivery to receiveCallBack and every other subscriber, acks still arrive
+)
+
+type subConfig struct {
+	buffer int
+	policy Policy
+}
+
+// SubscribeOption configures a subscription.
+type SubscribeOption func(*subConfig)
+
+func WithBuffer(n int) SubscribeOption {
+	return func(c *subConfig) {
+		c.buffer = n
+	}
+}
+
+func WithPolicy(p Policy) SubscribeOption {
+	return func(c *subConfig) {
+		c.policy = p
+	}
+}
+
+// hub hands published events to its subscribers.
+type hub struct {
+	mu   sync.RWMutex
+	subs []*subscriber
+}
+
+// subscriber is one channel handed out by Events, Results or Curves.
+type subscriber struct {
+	accept func(any) bool
+	send   func(any)
+	quit   chan struct{}
+}
+
+// subscribe registers a channel of T fed with the published events accepted
+// by accept. The returned func cancels the subscription and closes the
+// channel.
+func subscribe[T any](h *hub, accept func(any) bool, convert func(any) T, opts []SubscribeOption) (<-chan T, func()) {
+	cfg := subConfig{buffer: DefaultSubscribeBuffer, policy: DropNewest}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	ch := make(chan T, cfg.buffer)
+	s := &subscriber{accept: accept, quit: make(chan struct{})}
+	s.send = func(ev any) {
+		v := convert(ev)
+		switch cfg.policy {
+		case Block:
+			select {
+			case ch <- v:
+			case <-s.quit:
+			}
+		case DropOldest:
+			for {
+				select {
+				case ch <- v:
+					return
+				default:
+				}
+				select {
+				case <-ch:
+				default:
+				}
+			}
+		default:
+			select {
+			case ch <- v:
+			default:
+			}
+		}
+	}
+
+	h.mu.Lock()
+	h.subs = append(h.subs, s)
+	h.mu.Unlock()
+
+	var once sync.Once
+	cancel := func() {
+		once.Do(func() {
+			// quit first, so a blocked send gives up the read lock
+			close(s.quit)
+			h.mu.Lock()
+			for i, sub := range h.subs {
+				if sub == s {
+					h.subs = append(h.subs[:i:i], h.subs[i+1:]...)
+					break
+				}
+			}
+			h.mu.Unlock()
+			close(ch)
+		})
+	}
+	return ch, cancel
+}
+
+// publish hands an event, a received AnsData or something assembled from
+// it, to every subscriber that wants it.
+func (dc *DanikorTCPConnection) publish(ev any) {
+	dc.hub.publish(ev)
+}
+
+func (h *hub) publish(ev any) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	for _, s := range h.subs {
+		if s.accept(ev) {
+			s.send(ev)
+		}
+	}
+}
+
+// Events subscribes to every frame with the given MID that is not the ack
+// of a command, or to all of them when mid is empty. Subscriptions survive
+// reconnects; call the returned func to cancel one and close its channel.
+func (dc *DanikorTCPConnection) Events(mid string, opts ...SubscribeOption) (<-chan AnsData, func()) {
+	accept := func(ev any) bool {
+		ansData, ok := ev.(AnsData)
+		return ok && (mid == "" || ansData.MID == mid)
+	}
+	return subscribe(&dc.hub, accept, func(ev any) AnsData { return ev.(AnsData) }, opts)
+}
+
+// Results subscribes to the tightening results pushed after
+// SubscribeResultData.
+func (dc *DanikorTCPConnection) Results(opts ...SubscribeOption) (<-chan *DanitorTorqueResult, func()) {
+	accept := func(ev any) bool {
+		ansData, ok := ev.(AnsData)
+		return ok && ansData.AnsMode == ModeTransmit && ansData.MID == "0202" && ansData.TorqueResult != nil
+	}
+	return subscribe(&dc.hub, accept, func(ev any) *DanitorTorqueResult { return ev.(AnsData).TorqueResult }, opts)
+}
+
+// Curves subscribes to the real time curve fragments pushed after
+// SubscribeRealTimeData.
+func (dc *DanikorTCPConnection) Curves(opts ...SubscribeOption) (<-chan DanitorTorque, func()) {
+	accept := func(ev any) bool {
+		ansData, ok := ev.(AnsData)
+		return ok && ansData.AnsMode == ModeTransmit && ansData.MID == "0203"
+	}
+	return subscribe(&dc.hub, accept, func(ev any) DanitorTorque { return ev.(AnsData).Torque }, opts)
+}
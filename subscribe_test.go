@@ -0,0 +1,107 @@
+package danikor
+
+import (
+	"testing"
+	"time"
+)
+
+const (
+	testCurveFrame  = "02000000395430323033303130313d352c303b303130323d313b303230313d303b303230323d313b303330313d302e3030303b303330323d302e3030303b03"
+	testResultFrame = "02000000da543032303230303031303d302e3031322c302e3030302c332e3030302c313235372e3036393b30303031313d323b30303031323d35323b30313031303d302e3030302c302e3030302c302e3030303b30313031313d313b30313032303d302e3030302c302e3030302c302e3030303b30313032313d313b30313033303d302e3030302c302e3030302c302e3030303b30313033313d313b30313034303d302e3030302c302e3030302c302e3030303b30313034313d313b30313035303d302e3031322c313235372e3036392c332e3030303b30313035313d363b03"
+)
+
+func mustParse(t *testing.T, hexStr string) AnsData {
+	t.Helper()
+	ansData, err := parseData(mustHex(t, hexStr))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ansData
+}
+
+func TestSubscriptions(t *testing.T) {
+	dc := NewDanikorTCPConnection("", nil)
+	curve := mustParse(t, testCurveFrame)
+	result := mustParse(t, testResultFrame)
+
+	results1, cancel1 := dc.Results()
+	defer cancel1()
+	results2, cancel2 := dc.Results()
+	defer cancel2()
+	curves, cancel3 := dc.Curves()
+	defer cancel3()
+	curveEvents, cancel4 := dc.Events("0203")
+	defer cancel4()
+	all, cancel5 := dc.Events("")
+	defer cancel5()
+
+	dc.publish(curve)
+	dc.publish(result)
+
+	for _, results := range []<-chan *DanitorTorqueResult{results1, results2} {
+		if r := <-results; r.FinalStatus != FinalStatusNG {
+			t.Fatalf("unexpected result %+v", r)
+		}
+	}
+	if c := <-curves; c.Pset != "1" || !c.IsCurveStart {
+		t.Fatalf("unexpected curve %+v", c)
+	}
+	if e := <-curveEvents; e.MID != "0203" {
+		t.Fatalf("unexpected event %+v", e)
+	}
+	if len(curveEvents) != 0 || len(curves) != 0 || len(results1) != 0 {
+		t.Fatal("subscriber got a frame it did not ask for")
+	}
+	if len(all) != 2 {
+		t.Fatalf("Events(\"\") got %d frames, want 2", len(all))
+	}
+
+	cancel1()
+	if _, ok := <-results1; ok {
+		t.Fatal("channel not closed after cancel")
+	}
+	dc.publish(result) // must not panic on the cancelled subscription
+}
+
+func TestSubscriptionPolicies(t *testing.T) {
+	dc := NewDanikorTCPConnection("", nil)
+	frames := []AnsData{
+		{AnsMode: ModeTransmit, MID: "0203", Torque: DanitorTorque{Pset: "1"}},
+		{AnsMode: ModeTransmit, MID: "0203", Torque: DanitorTorque{Pset: "2"}},
+		{AnsMode: ModeTransmit, MID: "0203", Torque: DanitorTorque{Pset: "3"}},
+	}
+
+	newest, cancel1 := dc.Curves(WithBuffer(1), WithPolicy(DropNewest))
+	defer cancel1()
+	oldest, cancel2 := dc.Curves(WithBuffer(1), WithPolicy(DropOldest))
+	defer cancel2()
+	for _, f := range frames {
+		dc.publish(f)
+	}
+	if c := <-newest; c.Pset != "1" {
+		t.Errorf("DropNewest kept pset %s, want 1", c.Pset)
+	}
+	if c := <-oldest; c.Pset != "3" {
+		t.Errorf("DropOldest kept pset %s, want 3", c.Pset)
+	}
+	cancel1()
+	cancel2()
+
+	blocking, cancel3 := dc.Curves(WithBuffer(0), WithPolicy(Block))
+	published := make(chan struct{})
+	go func() {
+		dc.publish(frames[0])
+		dc.publish(frames[1])
+		close(published)
+	}()
+	if c := <-blocking; c.Pset != "1" {
+		t.Errorf("Block delivered pset %s, want 1", c.Pset)
+	}
+	select {
+	case <-published:
+		t.Fatal("publish did not block on a full subscriber")
+	case <-time.After(20 * time.Millisecond):
+	}
+	cancel3() // releases the blocked publish
+	<-published
+}
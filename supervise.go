@@ -0,0 +1,163 @@
+package danikor
+
+import (
+	"context"
+	"time"
+)
+
+// ConnState is the state of a connection supervised by Run.
+type ConnState int
+
+const (
+	StateDisconnected ConnState = iota
+	StateConnecting
+	StateConnected // first session is up
+	StateLost      // the link dropped, Run is about to redial
+	StateRestored  // a later session is up and the previous one is restored
+)
+
+func (s ConnState) String() string {
+	switch s {
+	case StateDisconnected:
+		return "disconnected"
+	case StateConnecting:
+		return "connecting"
+	case StateConnected:
+		return "connected"
+	case StateLost:
+		return "lost"
+	case StateRestored:
+		return "restored"
+	default:
+		return "unknown"
+	}
+}
+
+// session is what Run replays after a reconnect.
+type session struct {
+	pset          int       // last pset selected with ChosePset, 0 if none
+	subscriptions []string  // subscribed MIDs in the order they were sent
+	tool          ToolState // last EnableTool or DisableTool, ToolUnknown if none
+}
+
+func (dc *DanikorTCPConnection) rememberPset(pset int) {
+	dc.mu.Lock()
+	dc.session.pset = pset
+	dc.mu.Unlock()
+}
+
+func (dc *DanikorTCPConnection) rememberSubscription(mid string) {
+	dc.mu.Lock()
+	defer dc.mu.Unlock()
+	for _, m := range dc.session.subscriptions {
+		if m == mid {
+			return
+		}
+	}
+	dc.session.subscriptions = append(dc.session.subscriptions, mid)
+}
+
+// State returns the current state of the connection.
+func (dc *DanikorTCPConnection) State() ConnState {
+	dc.mu.Lock()
+	defer dc.mu.Unlock()
+	return dc.state
+}
+
+func (dc *DanikorTCPConnection) setState(s ConnState) {
+	dc.mu.Lock()
+	dc.state = s
+	dc.mu.Unlock()
+	dc.logger.Info("danikor: connection state", "addr", dc.address, "state", s)
+	if dc.stateCallBack != nil {
+		dc.stateCallBack(s)
+	}
+}
+
+// restoreSession establishes communication on a fresh connection and
+// re-applies the tool state, pset and subscriptions of the previous one, in
+// order. With WithToolFailSafe the tool is locked instead.
+func (dc *DanikorTCPConnection) restoreSession(ctx context.Context) error {
+	dc.mu.Lock()
+	pset := dc.session.pset
+	subscriptions := append([]string(nil), dc.session.subscriptions...)
+	tool := dc.session.tool
+	dc.mu.Unlock()
+
+	if _, err := dc.Establish(ctx); err != nil {
+		return err
+	}
+	if dc.toolFailSafe {
+		tool = ToolDisabled
+	}
+	if tool != ToolUnknown {
+		if _, err := dc.setTool(ctx, tool); err != nil {
+			return err
+		}
+	}
+	if pset != 0 {
+		if _, err := dc.ChosePset(ctx, pset); err != nil {
+			return err
+		}
+	}
+	for _, mid := range subscriptions {
+		if _, err := dc.Do(ctx, NewRequest(ModeRead, mid)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Run keeps the connection up until ctx is done. It dials, sends the MID
+// 0001 establish and, after every reconnect, re-applies the tool state,
+// re-selects the last pset and re-subscribes to everything subscribed
+// before. Progress is reported to
+// the state callback; Run only returns when ctx is done or dialing gives up.
+//
+// Commands can be issued from any goroutine while Run is active, typically
+// from the state callback on StateConnected.
+func (dc *DanikorTCPConnection) Run(ctx context.Context) error {
+	defer dc.setState(StateDisconnected)
+
+	restored := false
+	for {
+		dc.setState(StateConnecting)
+		if err := dc.DialContext(ctx); err != nil {
+			return err
+		}
+		dc.mu.Lock()
+		done := dc.done
+		dc.mu.Unlock()
+
+		if err := dc.restoreSession(ctx); err != nil {
+			dc.reportError(err)
+			dc.Close()
+			<-done
+		} else {
+			if restored {
+				dc.setState(StateRestored)
+			} else {
+				dc.setState(StateConnected)
+			}
+			restored = true
+
+			select {
+			case <-done:
+			case <-ctx.Done():
+				dc.Close()
+				<-done
+				return ctx.Err()
+			}
+		}
+		dc.setState(StateLost)
+
+		// do not hammer a controller that drops us right after connecting
+		timer := time.NewTimer(dc.backoff.delay(1))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
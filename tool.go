@@ -0,0 +1,88 @@
+package danikor
+
+import (
+	"context"
+	"fmt"
+)
+
+// ToolState is whether the controller lets the screwdriver run.
+type ToolState int
+
+const (
+	ToolUnknown  ToolState = iota // not commanded or queried on this link yet
+	ToolEnabled                   // the tool runs when triggered
+	ToolDisabled                  // the tool is locked
+)
+
+func (s ToolState) String() string {
+	switch s {
+	case ToolEnabled:
+		return "enabled"
+	case ToolDisabled:
+		return "disabled"
+	default:
+		return "unknown"
+	}
+}
+
+// DefaultToolMID is the MID that enables the tool with 01=1 and locks it
+// with 01=0. It is not part of the protocol documents this package was
+// written from and no capture confirms it: check it against the parameter
+// table of your controller's firmware and pass the right one with
+// WithToolMID. A controller that acks any write would otherwise report the
+// tool locked while nothing was locked.
+const DefaultToolMID = "0304" //mid 工具使能
+
+// EnableTool unlocks the tool, e.g. once a valid part has been scanned.
+func (dc *DanikorTCPConnection) EnableTool(ctx context.Context) (AnsData, error) {
+	return dc.setTool(ctx, ToolEnabled)
+}
+
+// DisableTool locks the tool; triggering it does nothing until EnableTool.
+func (dc *DanikorTCPConnection) DisableTool(ctx context.Context) (AnsData, error) {
+	return dc.setTool(ctx, ToolDisabled)
+}
+
+func (dc *DanikorTCPConnection) setTool(ctx context.Context, s ToolState) (AnsData, error) {
+	value := "0"
+	if s == ToolEnabled {
+		value = "1"
+	}
+	ack, err := dc.Do(ctx, NewRequest(ModeWrite, dc.toolMID, Param{"01", value}))
+	if err == nil {
+		dc.mu.Lock()
+		dc.tool = s
+		dc.session.tool = s
+		dc.mu.Unlock()
+	}
+	return ack, err
+}
+
+// ToolState returns the tool state last commanded or queried on the current
+// link. It is ToolUnknown after the link was lost until the session is
+// restored or the state is queried again.
+func (dc *DanikorTCPConnection) ToolState() ToolState {
+	dc.mu.Lock()
+	defer dc.mu.Unlock()
+	return dc.tool
+}
+
+// QueryToolState reads the tool state from the controller.
+func (dc *DanikorTCPConnection) QueryToolState(ctx context.Context) (ToolState, error) {
+	params, err := dc.ReadParams(ctx, dc.toolMID, "01")
+	if err != nil {
+		return ToolUnknown, err
+	}
+	enabled, err := params.Bool("01")
+	if err != nil {
+		return ToolUnknown, fmt.Errorf("tool state: %w", err)
+	}
+	s := ToolDisabled
+	if enabled {
+		s = ToolEnabled
+	}
+	dc.mu.Lock()
+	dc.tool = s
+	dc.mu.Unlock()
+	return s, nil
+}
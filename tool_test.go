@@ -0,0 +1,95 @@
+package danikor
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestToolFailSafe(t *testing.T) {
+	addr, requests := ackServer(t, func(connNum int, req *Request) bool {
+		return connNum == 1 && req.MID == "0202"
+	})
+	states := make(chan ConnState, 16)
+	dc := NewDanikorTCPConnection(addr, nil,
+		WithBackoff(time.Millisecond, time.Millisecond),
+		WithErrorCallBack(func(error) {}),
+		WithToolFailSafe(),
+		WithStateCallBack(func(s ConnState) { states <- s }))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go dc.Run(ctx)
+	waitState := func(want ConnState) {
+		t.Helper()
+		for {
+			select {
+			case s := <-states:
+				if s == want {
+					return
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatalf("timeout waiting for state %v", want)
+			}
+		}
+	}
+
+	waitState(StateConnected)
+	if got := dc.ToolState(); got != ToolDisabled {
+		t.Fatalf("tool %v after connect, want disabled", got)
+	}
+	if _, err := dc.EnableTool(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if got := dc.ToolState(); got != ToolEnabled {
+		t.Fatalf("tool %v, want enabled", got)
+	}
+	if _, err := dc.SubscribeResultData(ctx); err != nil {
+		t.Fatal(err)
+	}
+	waitState(StateRestored)
+	if got := dc.ToolState(); got != ToolDisabled {
+		t.Fatalf("tool %v after reconnect, want disabled", got)
+	}
+
+	want := []string{
+		"1 R0001", "1 W030401=0;", "1 W030401=1;", "1 R0202",
+		"2 R0001", "2 W030401=0;", "2 R0202",
+	}
+	for _, w := range want {
+		if got := <-requests; got != w {
+			t.Fatalf("got request %q, want %q", got, w)
+		}
+	}
+}
+
+func TestQueryToolState(t *testing.T) {
+	store := map[string]map[string]string{"0304": {"01": "0"}}
+	dc := paramServer(t, store)
+	ctx := context.Background()
+
+	if got := dc.ToolState(); got != ToolUnknown {
+		t.Fatalf("tool %v before query, want unknown", got)
+	}
+	if s, err := dc.QueryToolState(ctx); err != nil || s != ToolDisabled {
+		t.Fatalf("got %v %v, want disabled", s, err)
+	}
+	if _, err := dc.EnableTool(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if store["0304"]["01"] != "1" {
+		t.Fatalf("enable not written: %v", store)
+	}
+	if s, err := dc.QueryToolState(ctx); err != nil || s != ToolEnabled {
+		t.Fatalf("got %v %v, want enabled", s, err)
+	}
+
+	// a controller keeping the interlock elsewhere
+	WithToolMID("0399")(dc)
+	if _, err := dc.DisableTool(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if store["0399"]["01"] != "0" || store["0304"]["01"] != "1" {
+		t.Fatalf("disable not written to 0399: %v", store)
+	}
+}